@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	signatureHeader = "X-Shawarma-Signature"
+	timestampHeader = "X-Shawarma-Timestamp"
+
+	signaturePrefix = "sha256="
+)
+
+// Adds authentication headers to a notification request. Files are read on each request so that
+// rotated secrets and projected tokens are picked up without a restart.
+func authenticateRequest(req *http.Request, config *NotifierConfig, body []byte, now time.Time) error {
+	if config.BearerTokenFile != "" {
+		token, err := readSecretFile(config.BearerTokenFile)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+string(token))
+	}
+
+	if config.HMACSecretFile != "" {
+		secret, err := readSecretFile(config.HMACSecretFile)
+		if err != nil {
+			return err
+		}
+
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, signaturePrefix+computeSignature(secret, timestamp, body))
+	}
+
+	return nil
+}
+
+// Computes the hex encoded HMAC-SHA256 of the timestamp and body, separated by a period.
+// Including the timestamp allows receivers to reject replayed requests.
+func computeSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Reads a secret from a file, ignoring leading and trailing whitespace
+func readSecretFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("secret file is empty: " + path)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestSecret(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+
+	return path
+}
+
+func TestAuthenticateRequest_BearerToken(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &NotifierConfig{
+		BearerTokenFile: writeTestSecret(t, "token", "my-token\n"),
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/applicationstate", nil)
+	err := authenticateRequest(req, config, []byte("{}"), time.Now())
+
+	assert.Nil(err)
+	assert.Equal("Bearer my-token", req.Header.Get("Authorization"))
+}
+
+func TestAuthenticateRequest_HMACSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &NotifierConfig{
+		HMACSecretFile: writeTestSecret(t, "secret", "my-secret"),
+	}
+	body := []byte(`{"status":"active","activeServices":["svc"]}`)
+	now := time.Unix(1700000000, 0)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/applicationstate", nil)
+	err := authenticateRequest(req, config, body, now)
+
+	assert.Nil(err)
+	assert.Equal("1700000000", req.Header.Get(timestampHeader))
+
+	// Verify as a receiver would
+	mac := hmac.New(sha256.New, []byte("my-secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(expected, req.Header.Get(signatureHeader))
+}
+
+func TestAuthenticateRequest_MissingFile_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &NotifierConfig{
+		BearerTokenFile: filepath.Join(t.TempDir(), "missing"),
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/applicationstate", nil)
+	err := authenticateRequest(req, config, []byte("{}"), time.Now())
+
+	assert.NotNil(err)
+}
+
+func TestAuthenticateRequest_EmptyFile_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &NotifierConfig{
+		HMACSecretFile: writeTestSecret(t, "secret", "\n"),
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/applicationstate", nil)
+	err := authenticateRequest(req, config, []byte("{}"), time.Now())
+
+	assert.NotNil(err)
+}
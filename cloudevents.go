@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	jsonPayloadFormat              = "json"
+	cloudEventsPayloadFormat       = "cloudevents"
+	cloudEventsBinaryPayloadFormat = "cloudevents-binary"
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventType         = "io.centeredge.shawarma.state.changed"
+
+	jsonContentType        = "application/json; charset=utf-8"
+	cloudEventsContentType = "application/cloudevents+json; charset=utf-8"
+)
+
+// CloudEvents 1.0 envelope used for structured mode
+type cloudEventDto struct {
+	SpecVersion     string         `json:"specversion"`
+	Type            string         `json:"type"`
+	Source          string         `json:"source"`
+	Subject         string         `json:"subject,omitempty"`
+	ID              string         `json:"id"`
+	Time            string         `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            stateChangeDto `json:"data"`
+}
+
+// Body and headers for a notification, which are the same for each attempt
+type notificationPayload struct {
+	body    []byte
+	headers map[string]string
+}
+
+// Returns the event ID for the state, which is the same when the state is resent or retried so
+// consumers can deduplicate, and like the ETag includes the epoch since the generation restarts from zero
+func cloudEventID(state *stateChangeDto) string {
+	return stateETagEpoch + "-" + strconv.FormatUint(state.Generation, 10)
+}
+
+// Builds the notification payload for the state in the configured format
+func buildPayload(config *NotifierConfig, state stateChangeDto) (*notificationPayload, error) {
+	switch config.PayloadFormat {
+	case "", jsonPayloadFormat:
+		body, err := json.Marshal(&state)
+		if err != nil {
+			return nil, err
+		}
+
+		return &notificationPayload{
+			body: body,
+			headers: map[string]string{
+				"Content-Type": jsonContentType,
+			},
+		}, nil
+
+	case cloudEventsPayloadFormat:
+		body, err := json.Marshal(&cloudEventDto{
+			SpecVersion:     cloudEventsSpecVersion,
+			Type:            cloudEventType,
+			Source:          config.EventSource,
+			Subject:         config.EventSubject,
+			ID:              cloudEventID(&state),
+			Time:            state.Timestamp.UTC().Format(time.RFC3339Nano),
+			DataContentType: "application/json",
+			Data:            state,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &notificationPayload{
+			body: body,
+			headers: map[string]string{
+				"Content-Type": cloudEventsContentType,
+			},
+		}, nil
+
+	case cloudEventsBinaryPayloadFormat:
+		body, err := json.Marshal(&state)
+		if err != nil {
+			return nil, err
+		}
+
+		headers := map[string]string{
+			"Content-Type":   jsonContentType,
+			"Ce-Specversion": cloudEventsSpecVersion,
+			"Ce-Type":        cloudEventType,
+			"Ce-Source":      config.EventSource,
+			"Ce-Id":          cloudEventID(&state),
+			"Ce-Time":        state.Timestamp.UTC().Format(time.RFC3339Nano),
+		}
+		if config.EventSubject != "" {
+			headers["Ce-Subject"] = config.EventSubject
+		}
+
+		return &notificationPayload{
+			body:    body,
+			headers: headers,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown payload format: %s", config.PayloadFormat)
+	}
+}
+
+// Returns an error if the payload format is not supported
+func validatePayloadFormat(format string) error {
+	switch format {
+	case "", jsonPayloadFormat, cloudEventsPayloadFormat, cloudEventsBinaryPayloadFormat:
+		return nil
+	default:
+		return fmt.Errorf("unknown payload format %q, expected %s, %s or %s",
+			format, jsonPayloadFormat, cloudEventsPayloadFormat, cloudEventsBinaryPayloadFormat)
+	}
+}
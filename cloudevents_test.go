@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testEventTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestEventConfig(format string) *NotifierConfig {
+	return &NotifierConfig{
+		PayloadFormat: format,
+		EventSource:   "/namespaces/default/pods/pod",
+		EventSubject:  "svc",
+	}
+}
+
+func TestBuildPayload_JSON(t *testing.T) {
+	assert := assert.New(t)
+
+	payload, err := buildPayload(newTestEventConfig(jsonPayloadFormat), stateChangeDto{
+		Status:         activeStatus,
+		ActiveServices: []string{"svc"},
+	})
+
+	assert.Nil(err)
+	assert.Equal(`{"status":"active","activeServices":["svc"]}`, string(payload.body))
+	assert.Equal(jsonContentType, payload.headers["Content-Type"])
+}
+
+func TestBuildPayload_CloudEventsStructured(t *testing.T) {
+	assert := assert.New(t)
+
+	payload, err := buildPayload(newTestEventConfig(cloudEventsPayloadFormat), stateChangeDto{
+		Status:         activeStatus,
+		ActiveServices: []string{"svc"},
+		Generation:     3,
+		Timestamp:      testEventTime,
+	})
+
+	assert.Nil(err)
+	assert.Equal(cloudEventsContentType, payload.headers["Content-Type"])
+
+	var event map[string]interface{}
+	if assert.Nil(json.Unmarshal(payload.body, &event)) {
+		assert.Equal("1.0", event["specversion"])
+		assert.Equal(cloudEventType, event["type"])
+		assert.Equal("/namespaces/default/pods/pod", event["source"])
+		assert.Equal("svc", event["subject"])
+		assert.Equal("2024-01-02T03:04:05Z", event["time"])
+		assert.Equal(stateETagEpoch+"-3", event["id"])
+		assert.Equal(map[string]interface{}{
+			"status":         "active",
+			"generation":     float64(3),
+			"timestamp":      "2024-01-02T03:04:05Z",
+			"activeServices": []interface{}{"svc"},
+		}, event["data"])
+	}
+}
+
+func TestBuildPayload_CloudEventsBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	payload, err := buildPayload(newTestEventConfig(cloudEventsBinaryPayloadFormat), stateChangeDto{
+		Status:         inactiveStatus,
+		ActiveServices: []string{},
+		Generation:     4,
+		Timestamp:      testEventTime,
+	})
+
+	assert.Nil(err)
+	assert.Equal(`{"status":"inactive","generation":4,"timestamp":"2024-01-02T03:04:05Z","activeServices":[]}`, string(payload.body))
+	assert.Equal(jsonContentType, payload.headers["Content-Type"])
+	assert.Equal("1.0", payload.headers["Ce-Specversion"])
+	assert.Equal(cloudEventType, payload.headers["Ce-Type"])
+	assert.Equal("/namespaces/default/pods/pod", payload.headers["Ce-Source"])
+	assert.Equal("svc", payload.headers["Ce-Subject"])
+	assert.Equal("2024-01-02T03:04:05Z", payload.headers["Ce-Time"])
+	assert.Equal(stateETagEpoch+"-4", payload.headers["Ce-Id"])
+}
+
+func TestValidatePayloadFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(validatePayloadFormat(""))
+	assert.Nil(validatePayloadFormat(cloudEventsPayloadFormat))
+	assert.NotNil(validatePayloadFormat("xml"))
+}
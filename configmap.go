@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// Keeps the current state, ignoring changes to the endpoints
+	frozenOverrideStatus = "frozen"
+
+	// Reasons for a change in state due to the override ConfigMap
+	configMapOverrideReason        = "ConfigMapOverride"
+	configMapOverrideClearedReason = "ConfigMapOverrideCleared"
+)
+
+// Rule within the override ConfigMap, which applies to the pod if all of the criteria which are set match
+type configMapOverrideEntry struct {
+	// Names of pods to which the rule applies
+	Pods []string `json:"pods,omitempty"`
+	// Label selector for pods to which the rule applies
+	Selector string `json:"selector,omitempty"`
+	// Name of a service in the pod's namespace, the rule applies to pods with an endpoint in the service
+	Service string `json:"service,omitempty"`
+	// Status to apply, active, inactive or frozen
+	Status string `json:"status"`
+}
+
+// Rule from the override ConfigMap which may apply to the pod
+type configMapOverrideRule struct {
+	key    string
+	status string
+	// Name of the service the pod must be in, empty to apply regardless of services
+	service string
+}
+
+// Parses the rules in the override ConfigMap which apply to the pod, excluding the service criteria
+// which depends on the endpoints. Rules are returned sorted by key, invalid rules are skipped.
+func parseOverrideConfigMap(configMap *corev1.ConfigMap, podName string, podLabels func() (labels.Set, error), logger *zap.Logger) []configMapOverrideRule {
+	keys := make([]string, 0, len(configMap.Data))
+	for key := range configMap.Data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	rules := []configMapOverrideRule{}
+	for _, key := range keys {
+		matches, rule, err := parseOverrideRule(key, configMap.Data[key], podName, podLabels)
+		if err != nil {
+			logger.Error("Invalid override rule",
+				zap.String("key", key),
+				zap.Error(err))
+			continue
+		}
+
+		if matches {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+func parseOverrideRule(key string, value string, podName string, podLabels func() (labels.Set, error)) (bool, configMapOverrideRule, error) {
+	var entry configMapOverrideEntry
+	if err := yaml.UnmarshalStrict([]byte(value), &entry); err != nil {
+		return false, configMapOverrideRule{}, err
+	}
+
+	switch entry.Status {
+	case activeStatus, inactiveStatus, frozenOverrideStatus:
+	default:
+		return false, configMapOverrideRule{}, fmt.Errorf("status must be %s, %s or %s", activeStatus, inactiveStatus, frozenOverrideStatus)
+	}
+	if len(entry.Pods) == 0 && entry.Selector == "" && entry.Service == "" {
+		return false, configMapOverrideRule{}, fmt.Errorf("must have at least one of pods, selector or service")
+	}
+
+	rule := configMapOverrideRule{
+		key:     key,
+		status:  entry.Status,
+		service: entry.Service,
+	}
+
+	if len(entry.Pods) > 0 && !slices.Contains(entry.Pods, podName) {
+		return false, rule, nil
+	}
+
+	if entry.Selector != "" {
+		selector, err := labels.Parse(entry.Selector)
+		if err != nil {
+			return false, rule, err
+		}
+
+		set, err := podLabels()
+		if err != nil {
+			return false, rule, err
+		}
+		if !selector.Matches(set) {
+			return false, rule, nil
+		}
+	}
+
+	return true, rule, nil
+}
+
+// Applies the rules from the override ConfigMap, or removes them if the ConfigMap is nil
+func (monitor *Monitor) processOverrideConfigMap(configMap *corev1.ConfigMap) {
+	monitor.overrideLock.Lock()
+	defer monitor.overrideLock.Unlock()
+
+	monitor.overrideConfigMap = configMap
+	monitor.applyOverrideConfigMapLocked()
+}
+
+// Reapplies the rules from the override ConfigMap if the labels of the pod have changed, since
+// rules with a selector may no longer match
+func (monitor *Monitor) processOverridePod(pod *corev1.Pod) {
+	monitor.overrideLock.Lock()
+	defer monitor.overrideLock.Unlock()
+
+	podLabels := labels.Set(pod.Labels)
+	if podLabels == nil {
+		podLabels = labels.Set{}
+	}
+	if monitor.overridePodLabels != nil && labels.Equals(monitor.overridePodLabels, podLabels) {
+		return
+	}
+
+	monitor.overridePodLabels = podLabels
+	if monitor.overrideConfigMap != nil {
+		monitor.applyOverrideConfigMapLocked()
+	}
+}
+
+// Parses and applies the rules from the latest override ConfigMap. Must be called while holding overrideLock.
+func (monitor *Monitor) applyOverrideConfigMapLocked() {
+	childLogger := monitor.Config.CreateChildLogger(monitor.Logger)
+
+	var rules []configMapOverrideRule
+	if monitor.overrideConfigMap != nil {
+		// Labels are only fetched if a rule has a selector and the pod has not yet been watched, and at most once
+		var podLabelsErr error
+		getPodLabels := func() (labels.Set, error) {
+			if monitor.overridePodLabels == nil && podLabelsErr == nil {
+				pod, err := monitor.clientset.CoreV1().Pods(monitor.Config.Namespace).Get(context.TODO(), monitor.Config.PodName, metav1.GetOptions{})
+				if err != nil {
+					podLabelsErr = err
+					return nil, err
+				}
+
+				monitor.overridePodLabels = labels.Set(pod.Labels)
+				if monitor.overridePodLabels == nil {
+					monitor.overridePodLabels = labels.Set{}
+				}
+			}
+
+			return monitor.overridePodLabels, podLabelsErr
+		}
+
+		rules = parseOverrideConfigMap(monitor.overrideConfigMap, monitor.Config.PodName, getPodLabels, childLogger)
+	}
+
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	previous := monitor.configMapOverrideLocked()
+	monitor.configMapRules = rules
+	current := monitor.configMapOverrideLocked()
+
+	if previous != nil && current == nil {
+		childLogger.Info("ConfigMap override cleared",
+			zap.String("key", previous.key))
+		monitor.observedReason = configMapOverrideClearedReason
+	} else if current != nil && (previous == nil || *previous != *current) {
+		childLogger.Info("ConfigMap override set",
+			zap.String("key", current.key),
+			zap.String("status", current.status))
+	}
+
+	monitor.reconcileLocked()
+}
+
+// Returns the first rule from the override ConfigMap which applies to the pod, nil if none.
+// Must be called while holding stateLock.
+func (monitor *Monitor) configMapOverrideLocked() *configMapOverrideRule {
+	for i := range monitor.configMapRules {
+		rule := &monitor.configMapRules[i]
+		if rule.service == "" {
+			return rule
+		}
+
+		for serviceName := range monitor.observedEndpointStatuses {
+			if serviceName.Name == rule.service {
+				return rule
+			}
+		}
+	}
+
+	return nil
+}
+
+// Watches the override ConfigMap, and the pod for changes to its labels, until the monitor is stopped
+func (monitor *Monitor) watchOverrideConfigMap() {
+	go monitor.watchOverridePod()
+
+	watchList := cache.NewFilteredListWatchFromClient(
+		monitor.clientset.CoreV1().RESTClient(),
+		"configmaps",
+		monitor.Config.Namespace,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", monitor.Config.OverrideConfigMap).String()
+		},
+	)
+
+	_, controller := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: watchList,
+			ObjectType:    &corev1.ConfigMap{},
+			ResyncPeriod:  time.Second * 0,
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					monitor.Logger.Debug("override configmap added")
+					monitor.processOverrideConfigMap(obj.(*corev1.ConfigMap))
+				},
+				DeleteFunc: func(obj interface{}) {
+					monitor.Logger.Debug("override configmap deleted")
+					monitor.processOverrideConfigMap(nil)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					monitor.Logger.Debug("override configmap changed")
+					monitor.processOverrideConfigMap(newObj.(*corev1.ConfigMap))
+				},
+			},
+		})
+
+	controller.Run(monitor.stop)
+}
+
+// Watches the pod so that rules with a selector are reapplied when its labels change
+func (monitor *Monitor) watchOverridePod() {
+	watchList := cache.NewFilteredListWatchFromClient(
+		monitor.clientset.CoreV1().RESTClient(),
+		"pods",
+		monitor.Config.Namespace,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", monitor.Config.PodName).String()
+		},
+	)
+
+	_, controller := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: watchList,
+			ObjectType:    &corev1.Pod{},
+			ResyncPeriod:  time.Second * 0,
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					monitor.processOverridePod(obj.(*corev1.Pod))
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					monitor.processOverridePod(newObj.(*corev1.Pod))
+				},
+			},
+		})
+
+	controller.Run(monitor.stop)
+}
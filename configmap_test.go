@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestOverrideConfigMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "shawarma-overrides",
+		},
+		Data: data,
+	}
+}
+
+func newTestConfigMapMonitor() *Monitor {
+	monitor := newTestMonitor(MonitorConfig{})
+
+	pod := newTestPod()
+	pod.Labels = map[string]string{"app": "my-app"}
+	monitor.clientset = fake.NewClientset(pod)
+
+	return monitor
+}
+
+func TestProcessOverrideConfigMap_Selector(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"other":     "selector: app=other-app\nstatus: active",
+		"migration": "selector: app=my-app\nstatus: inactive",
+	}))
+
+	state := monitor.currentState()
+	assert.Equal(inactiveStatus, state.status)
+	assert.True(state.overridden)
+	assert.Equal(configMapOverrideReason, state.reason)
+
+	// Deleting the ConfigMap returns to the state of the endpoints
+	monitor.processOverrideConfigMap(nil)
+
+	state = monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.False(state.overridden)
+	assert.Equal(configMapOverrideClearedReason, state.reason)
+}
+
+func TestProcessOverrideConfigMap_PodsAndService(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"canary": "pods: [pod]\nservice: svc\nstatus: active",
+	}))
+
+	// Not yet in the service
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+
+	// Applies once the pod has an endpoint in the service, even if not ready
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+	assert.Equal(activeStatus, monitor.currentState().status)
+	assert.True(monitor.currentState().overridden)
+}
+
+func TestProcessOverrideConfigMap_Frozen(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"freeze": "pods: [pod, other]\nstatus: frozen",
+	}))
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+
+	state := monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.True(state.overridden)
+}
+
+func TestProcessOverrideConfigMap_InvalidAndUnmatchedRules_Ignored(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"bad-status":   "pods: [pod]\nstatus: paused",
+		"no-criteria":  "status: inactive",
+		"unknown-key":  "pod: pod\nstatus: inactive",
+		"other-pod":    "pods: [other]\nstatus: inactive",
+		"other-labels": "selector: app=other-app\nstatus: inactive",
+	}))
+
+	state := monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.False(state.overridden)
+}
+
+func TestProcessOverrideConfigMap_PodOverrideTakesPrecedence(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"migration": "selector: app=my-app\nstatus: inactive",
+	}))
+	monitor.setOverride(activeStatus, 0)
+
+	assert.Equal(activeStatus, monitor.currentState().status)
+	assert.Equal(overrideReason, monitor.currentState().reason)
+
+	monitor.clearOverride()
+
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+	assert.Equal(configMapOverrideReason, monitor.currentState().reason)
+}
+
+func TestProcessOverridePod_LabelsChanged_Reapplies(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestConfigMapMonitor()
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	monitor.processOverrideConfigMap(newTestOverrideConfigMap(map[string]string{
+		"migration": "selector: app=my-app\nstatus: inactive",
+	}))
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+
+	// The label is removed from the pod, so the rule no longer applies
+	pod := newTestPod()
+	pod.Labels = map[string]string{"app": "other-app"}
+	monitor.processOverridePod(pod)
+
+	state := monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.Equal(configMapOverrideClearedReason, state.reason)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons for events recorded against the pod
+const (
+	activatedEventReason          = "Activated"
+	deactivatedEventReason        = "Deactivated"
+	drainingEventReason           = "Draining"
+	previewingEventReason         = "Previewing"
+	endpointsChangedEventReason   = "EndpointsChanged"
+	notificationFailedEventReason = "NotificationFailed"
+)
+
+// Records Kubernetes events against the pod. A nil recorder discards events, so callers
+// need not check whether events are enabled.
+type podEventRecorder struct {
+	recorder record.EventRecorder
+	pod      *corev1.ObjectReference
+}
+
+func (recorder *podEventRecorder) event(eventType string, reason string, message string) {
+	if recorder == nil {
+		return
+	}
+
+	recorder.recorder.Event(recorder.pod, eventType, reason, message)
+}
+
+// Starts recording events against the pod, returning the recorder and a function to stop recording
+func (monitor *Monitor) startEventRecorder() (*podEventRecorder, func()) {
+	pod := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  monitor.Config.Namespace,
+		Name:       monitor.Config.PodName,
+		UID:        monitor.Config.PodUID,
+	}
+
+	// kubectl describe only shows events which include the UID, so look it up if not supplied
+	if pod.UID == "" {
+		podObject, err := monitor.clientset.CoreV1().Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		if err != nil {
+			monitor.Logger.Warn("Unable to get pod UID for events, set --pod-uid to supply it",
+				zap.Error(err))
+		} else {
+			pod.UID = podObject.UID
+		}
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: monitor.clientset.CoreV1().Events(pod.Namespace),
+	})
+
+	return &podEventRecorder{
+		recorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "shawarma"}),
+		pod:      pod,
+	}, broadcaster.Shutdown
+}
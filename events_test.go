@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestEventRecorder() (*podEventRecorder, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+
+	return &podEventRecorder{
+		recorder: recorder,
+		pod:      &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod"},
+	}, recorder
+}
+
+func TestApplyState_RecordsEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+	var recorder *record.FakeRecorder
+	monitor.events, recorder = newTestEventRecorder()
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("other", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("other", true, "another"), false, false)
+
+	assert.Equal("Normal Activated Active in default/svc (EndpointAdded)", <-recorder.Events)
+	assert.Equal("Normal EndpointsChanged Services changed to default/other, default/svc (EndpointAdded)", <-recorder.Events)
+	assert.Equal("Normal EndpointsChanged Services changed to default/other (EndpointUnready)", <-recorder.Events)
+	assert.Equal("Normal Deactivated Not active in any service (EndpointRemoved)", <-recorder.Events)
+}
+
+func TestApplyState_InitiallyInactive_RecordsNoEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+	var recorder *record.FakeRecorder
+	monitor.events, recorder = newTestEventRecorder()
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "other"), false, false)
+
+	// The state is still published, but without an event
+	assert.Len(monitor.stateChange, 1)
+	assert.Empty(recorder.Events)
+}
+
+func TestPodEventRecorder_Nil_DiscardsEvents(t *testing.T) {
+	var recorder *podEventRecorder
+
+	assert.NotPanics(t, func() {
+		recorder.event(corev1.EventTypeNormal, activatedEventReason, "Active")
+	})
+}
+
+func TestNotifier_Failure_RecordsEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := newNotifier(NotifierConfig{
+		Command: []string{"/bin/false"},
+		Retry:   RetryPolicy{MaxAttempts: 1},
+	})
+	var recorder *record.FakeRecorder
+	notifier.events, recorder = newTestEventRecorder()
+
+	notifier.start(stateChangeDto{Status: activeStatus}, zap.NewNop())
+	<-notifier.done
+
+	select {
+	case event := <-recorder.Events:
+		assert.Contains(event, "Warning NotificationFailed Failed to notify /bin/false of active state")
+	case <-time.After(time.Second):
+		t.Fatal("expected a NotificationFailed event")
+	}
+}
+
+func TestStartEventRecorder_LooksUpPodUID(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := newTestPod()
+	pod.UID = "1234"
+
+	monitor := NewMonitor(MonitorConfig{Namespace: "default", PodName: "pod"}, zap.NewNop())
+	monitor.clientset = fake.NewClientset(pod)
+
+	events, stop := monitor.startEventRecorder()
+	defer stop()
+
+	assert.Equal(pod.UID, events.pod.UID)
+}
+
+func TestStartEventRecorder_MissingPod_RecordsWithoutUID(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := NewMonitor(MonitorConfig{Namespace: "default", PodName: "pod"}, zap.NewNop())
+	monitor.clientset = fake.NewClientset()
+
+	events, stop := monitor.startEventRecorder()
+	defer stop()
+
+	assert.Empty(events.pod.UID)
+	events.event(corev1.EventTypeNormal, activatedEventReason, "Active")
+}
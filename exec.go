@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Maximum amount of command output included in errors
+const maxExecOutput = 1024
+
+// Describes a command which exited with a non-zero exit code
+type exitCodeError struct {
+	exitCode  int
+	permanent bool
+	output    string
+}
+
+func (err *exitCodeError) Error() string {
+	message := fmt.Sprintf("command exited with code %d", err.exitCode)
+	if err.output != "" {
+		message += ": " + err.output
+	}
+
+	return message
+}
+
+func (err *exitCodeError) retryable() bool {
+	return !err.permanent
+}
+
+func (err *exitCodeError) retryDelay() time.Duration {
+	return 0
+}
+
+// Notifies of a state change by executing the configured command, retrying on failure
+func execStateChange(ctx context.Context, config *NotifierConfig, state stateChangeDto, logger *zap.Logger) error {
+	input, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		"SHAWARMA_STATUS="+state.Status,
+		"SHAWARMA_PREVIOUS_STATUS="+state.PreviousStatus,
+		"SHAWARMA_ACTIVE_SERVICES="+strings.Join(state.ActiveServices, ","),
+		"SHAWARMA_REASON="+state.Reason,
+		"SHAWARMA_GENERATION="+strconv.FormatUint(state.Generation, 10),
+	)
+	if state.Shard != nil {
+		env = append(env,
+			"SHAWARMA_SHARD_INDEX="+strconv.Itoa(state.Shard.Index),
+			"SHAWARMA_SHARD_COUNT="+strconv.Itoa(state.Shard.Count),
+		)
+	}
+
+	return retryNotification(ctx, config.Retry, config.target(), logger, func(ctx context.Context) error {
+		return execAttempt(ctx, config, env, input, logger)
+	})
+}
+
+// Makes a single attempt to execute the command, passing the state as JSON on stdin
+func execAttempt(ctx context.Context, config *NotifierConfig, env []string, input []byte, logger *zap.Logger) error {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, config.Command[0], config.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait indefinitely for output from child processes which outlive a killed command
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+
+	logger.Debug("Command result",
+		zap.String("output", output.String()),
+		zap.Error(err),
+	)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		trimmed := strings.TrimSpace(output.String())
+		if len(trimmed) > maxExecOutput {
+			trimmed = trimmed[:maxExecOutput]
+		}
+
+		return &exitCodeError{
+			exitCode:  exitErr.ExitCode(),
+			permanent: slices.Contains(config.PermanentExitCodes, exitErr.ExitCode()),
+			output:    trimmed,
+		}
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// Report the timeout or cancellation rather than the resulting kill signal
+		return errors.Join(err, ctx.Err())
+	}
+
+	return err
+}
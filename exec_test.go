@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestExecStateChange_PassesStateToCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	output := filepath.Join(t.TempDir(), "output")
+	config := &NotifierConfig{
+		Command: []string{"/bin/sh", "-c", `echo "$SHAWARMA_STATUS $SHAWARMA_PREVIOUS_STATUS $SHAWARMA_ACTIVE_SERVICES" > "$0"; cat >> "$0"`, output},
+		Retry:   testRetryPolicy,
+	}
+
+	err := execStateChange(context.Background(), config, stateChangeDto{
+		Status:         activeStatus,
+		ActiveServices: []string{"svc1", "svc2"},
+		PreviousStatus: inactiveStatus,
+	}, zap.NewNop())
+
+	assert.Nil(err)
+
+	data, err := os.ReadFile(output)
+	if assert.Nil(err) {
+		assert.Equal("active inactive svc1,svc2\n"+`{"status":"active","previousStatus":"inactive","activeServices":["svc1","svc2"]}`, string(data))
+	}
+}
+
+func TestExecStateChange_NonZeroExit_Retries(t *testing.T) {
+	assert := assert.New(t)
+
+	counter := filepath.Join(t.TempDir(), "counter")
+	config := &NotifierConfig{
+		// Fails until the command has been run 3 times
+		Command: []string{"/bin/sh", "-c", `echo x >> "$0"; [ $(wc -l < "$0") -ge 3 ]`, counter},
+		Retry:   testRetryPolicy,
+	}
+
+	err := execStateChange(context.Background(), config, getState(), zap.NewNop())
+
+	assert.Nil(err)
+}
+
+func TestExecStateChange_PermanentExitCode_DoesNotRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	counter := filepath.Join(t.TempDir(), "counter")
+	config := &NotifierConfig{
+		Command:            []string{"/bin/sh", "-c", `echo x >> "$0"; echo failed; exit 2`, counter},
+		PermanentExitCodes: []int{2},
+		Retry:              testRetryPolicy,
+	}
+
+	err := execStateChange(context.Background(), config, getState(), zap.NewNop())
+
+	var exitErr *exitCodeError
+	if assert.True(errors.As(err, &exitErr)) {
+		assert.Equal(2, exitErr.exitCode)
+		assert.Equal("failed", exitErr.output)
+	}
+
+	data, _ := os.ReadFile(counter)
+	assert.Equal("x\n", string(data))
+}
+
+func TestExecStateChange_Timeout_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &NotifierConfig{
+		Command: []string{"/bin/sh", "-c", "sleep 5"},
+		Timeout: 20 * time.Millisecond,
+		Retry:   RetryPolicy{MaxAttempts: 1},
+	}
+
+	err := execStateChange(context.Background(), config, getState(), zap.NewNop())
+
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Tracks the health of the watch on the Kubernetes API, for the liveness and readiness endpoints
+type watchHealth struct {
+	// Number of consecutive failures to list, such as when relisting after the watch is dropped,
+	// above which the sidecar is not live
+	MaxRestarts int
+	// Time the watch may remain disconnected before the sidecar is not live, or 0 for no limit
+	MaxDisconnect time.Duration
+
+	lock sync.Mutex
+	// True once the informer has synced its initial list
+	synced bool
+	// Consecutive failures to list
+	listFailures int
+	// Time of the first failed list or watch since the last success, zero if connected
+	disconnectedSince time.Time
+	// Most recent list or watch error, for diagnostics
+	lastError error
+}
+
+func newWatchHealth(maxRestarts int, maxDisconnect time.Duration) *watchHealth {
+	return &watchHealth{
+		MaxRestarts:   maxRestarts,
+		MaxDisconnect: maxDisconnect,
+	}
+}
+
+// Records that the informer has synced its initial list
+func (health *watchHealth) setSynced() {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	health.synced = true
+}
+
+// Records the result of a list request
+func (health *watchHealth) observeList(err error, now time.Time) {
+	health.observe(err, now)
+
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if err == nil {
+		health.listFailures = 0
+	} else {
+		health.listFailures++
+	}
+}
+
+// Records the result of a list or watch request
+func (health *watchHealth) observe(err error, now time.Time) {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	health.lastError = err
+	if err == nil {
+		health.disconnectedSince = time.Time{}
+	} else if health.disconnectedSince.IsZero() {
+		health.disconnectedSince = now
+	}
+}
+
+// Returns an empty string if live, otherwise the reason the sidecar is not live
+func (health *watchHealth) liveness(now time.Time) string {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if health.MaxRestarts > 0 && health.listFailures > health.MaxRestarts {
+		return "listing failed repeatedly: " + health.lastError.Error()
+	}
+	if health.MaxDisconnect > 0 && !health.disconnectedSince.IsZero() &&
+		now.Sub(health.disconnectedSince) > health.MaxDisconnect {
+		return "watch disconnected: " + health.lastError.Error()
+	}
+
+	return ""
+}
+
+// Returns an empty string if ready, otherwise the reason the sidecar is not ready
+func (health *watchHealth) readiness() string {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+
+	if !health.synced {
+		if health.lastError != nil {
+			return "informer not synced: " + health.lastError.Error()
+		}
+		return "informer not synced"
+	}
+
+	return ""
+}
+
+type healthDto struct {
+	Health string `json:"health"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, reason string) {
+	dto := healthDto{Health: "ok"}
+	status := http.StatusOK
+	if reason != "" {
+		dto = healthDto{Health: "failed", Reason: reason}
+		status = http.StatusServiceUnavailable
+	}
+
+	bytes, err := json.Marshal(&dto)
+	if err != nil {
+		panic("Json encoding issue: " + err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(bytes); err != nil {
+		panic("Write issue: " + err.Error())
+	}
+}
+
+func (health *watchHealth) livez(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, health.liveness(time.Now()))
+}
+
+func (health *watchHealth) readyz(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, health.readiness())
+}
+
+// Wraps a ListerWatcher to record whether requests to the Kubernetes API are succeeding, and which
+// objects were returned when relisting after the watch was dropped
+type healthListerWatcher struct {
+	cache.ListerWatcher
+	health *watchHealth
+
+	lock sync.Mutex
+	// True once the initial list has succeeded
+	listed bool
+	// Resource version of each object in the most recent relist, by namespace and name
+	relisted map[string]string
+}
+
+func newHealthListerWatcher(lw cache.ListerWatcher, health *watchHealth) *healthListerWatcher {
+	return &healthListerWatcher{
+		ListerWatcher: lw,
+		health:        health,
+	}
+}
+
+func (lw *healthListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := lw.ListerWatcher.List(options)
+	lw.health.observeList(err, time.Now())
+	if err == nil {
+		lw.recordList(list)
+	}
+	return list, err
+}
+
+// Records the objects returned by a relist, which the informer then applies as changes
+func (lw *healthListerWatcher) recordList(list runtime.Object) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	if !lw.listed {
+		// The initial list, not a relist
+		lw.listed = true
+		return
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return
+	}
+
+	lw.relisted = make(map[string]string, len(items))
+	for _, item := range items {
+		if object, err := meta.Accessor(item); err == nil {
+			lw.relisted[object.GetNamespace()+"/"+object.GetName()] = object.GetResourceVersion()
+		}
+	}
+}
+
+// Returns true if the object was received from a relist, rather than the watch
+func (lw *healthListerWatcher) isRelisted(object metav1.Object) bool {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+
+	key := object.GetNamespace() + "/" + object.GetName()
+	resourceVersion, ok := lw.relisted[key]
+	if !ok || resourceVersion != object.GetResourceVersion() {
+		return false
+	}
+
+	// Later changes to the object come from the watch
+	delete(lw.relisted, key)
+	return true
+}
+
+func (lw *healthListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	watcher, err := lw.ListerWatcher.Watch(options)
+	lw.health.observe(err, time.Now())
+	return watcher, err
+}
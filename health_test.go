@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatchHealth_Readiness_RequiresSync(t *testing.T) {
+	assert := assert.New(t)
+
+	health := newWatchHealth(0, 0)
+	health.observe(errors.New("forbidden"), time.Now())
+
+	assert.Equal("informer not synced: forbidden", health.readiness())
+
+	health.setSynced()
+	assert.Empty(health.readiness())
+}
+
+func TestWatchHealth_Liveness_ListFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	health := newWatchHealth(2, 0)
+	now := time.Now()
+
+	health.observeList(errors.New("forbidden"), now)
+	health.observeList(errors.New("forbidden"), now)
+	assert.Empty(health.liveness(now))
+
+	health.observeList(errors.New("forbidden"), now)
+	assert.Equal("listing failed repeatedly: forbidden", health.liveness(now))
+
+	// A successful list resets the count
+	health.observeList(nil, now)
+	assert.Empty(health.liveness(now))
+}
+
+func TestWatchHealth_Liveness_Disconnected(t *testing.T) {
+	assert := assert.New(t)
+
+	health := newWatchHealth(0, time.Minute)
+	now := time.Now()
+
+	health.observe(errors.New("connection refused"), now)
+	health.observe(errors.New("connection refused"), now.Add(30*time.Second))
+	assert.Empty(health.liveness(now.Add(time.Minute)))
+	assert.Equal("watch disconnected: connection refused", health.liveness(now.Add(2*time.Minute)))
+
+	reconnected := now.Add(2 * time.Minute)
+	health.observe(nil, reconnected)
+	assert.Empty(health.liveness(reconnected.Add(time.Minute)))
+}
+
+func TestWatchHealth_Handlers(t *testing.T) {
+	assert := assert.New(t)
+
+	health := newWatchHealth(0, 0)
+
+	w := httptest.NewRecorder()
+	health.readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal(`{"health":"failed","reason":"informer not synced"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	health.livez(w, httptest.NewRequest("GET", "/livez", nil))
+	assert.Equal(http.StatusOK, w.Code)
+}
+
+type failingListerWatcher struct{}
+
+func (failingListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	return nil, errors.New("forbidden")
+}
+
+func (failingListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewEmptyWatch(), nil
+}
+
+func TestHealthListerWatcher_ObservesErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	health := newWatchHealth(0, time.Nanosecond)
+	var lw cache.ListerWatcher = newHealthListerWatcher(failingListerWatcher{}, health)
+
+	_, err := lw.List(metav1.ListOptions{})
+	assert.NotNil(err)
+	time.Sleep(time.Millisecond)
+	assert.NotEmpty(health.liveness(time.Now()))
+
+	_, err = lw.Watch(metav1.ListOptions{})
+	assert.Nil(err)
+	assert.Empty(health.liveness(time.Now()))
+}
+
+type listListerWatcher struct {
+	list *discovery.EndpointSliceList
+}
+
+func (lw *listListerWatcher) List(options metav1.ListOptions) (runtime.Object, error) {
+	return lw.list, nil
+}
+
+func (lw *listListerWatcher) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewEmptyWatch(), nil
+}
+
+func TestHealthListerWatcher_IsRelisted(t *testing.T) {
+	assert := assert.New(t)
+
+	endpointSlice := newTestEndpointSlice("svc", true, "pod")
+	endpointSlice.ResourceVersion = "1"
+
+	inner := &listListerWatcher{&discovery.EndpointSliceList{Items: []discovery.EndpointSlice{*endpointSlice}}}
+	lw := newHealthListerWatcher(inner, newWatchHealth(0, 0))
+
+	// Objects from the initial list are not a resync
+	_, err := lw.List(metav1.ListOptions{})
+	assert.Nil(err)
+	assert.False(lw.isRelisted(endpointSlice))
+
+	changed := endpointSlice.DeepCopy()
+	changed.ResourceVersion = "2"
+	inner.list = &discovery.EndpointSliceList{Items: []discovery.EndpointSlice{*changed}}
+
+	_, err = lw.List(metav1.ListOptions{})
+	assert.Nil(err)
+	assert.False(lw.isRelisted(endpointSlice))
+	assert.True(lw.isRelisted(changed))
+
+	// Only the first change after the relist
+	assert.False(lw.isRelisted(changed))
+}
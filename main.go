@@ -3,18 +3,26 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/urfave/cli/v3"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	klog "k8s.io/klog/v2"
 )
 
 // Set on build
 var version string
 
+const defaultURL = "http://localhost/applicationstate"
+
 func main() {
 	logLevel := zap.NewAtomicLevelAt(zap.WarnLevel)
 	logConfig := zap.NewProductionConfig()
@@ -82,12 +90,27 @@ func main() {
 					Usage:   "Kubernetes service labels to monitor for this pod, comma-delimited ex. \"label1=value1,label2=value2\"",
 					Sources: cli.EnvVars("SHAWARMA_SERVICE_LABELS"),
 				},
+				&cli.StringFlag{
+					Name:    "rollout-active-service",
+					Usage:   "Argo Rollouts active service to monitor instead of --service, the pod is active if in this service",
+					Sources: cli.EnvVars("SHAWARMA_ROLLOUT_ACTIVE_SERVICE"),
+				},
+				&cli.StringFlag{
+					Name:    "rollout-preview-service",
+					Usage:   "Argo Rollouts preview service, the pod is preview if in this service but not the active service",
+					Sources: cli.EnvVars("SHAWARMA_ROLLOUT_PREVIEW_SERVICE"),
+				},
 				&cli.StringFlag{
 					Name:    "pod",
 					Aliases: []string{"p"},
 					Usage:   "Kubernetes pod to monitor",
 					Sources: cli.EnvVars("MY_POD_NAME"),
 				},
+				&cli.StringFlag{
+					Name:    "pod-uid",
+					Usage:   "UID of the Kubernetes pod, used for events, looked up if not supplied",
+					Sources: cli.EnvVars("MY_POD_UID"),
+				},
 				&cli.StringFlag{
 					Name:    "namespace",
 					Aliases: []string{"n"},
@@ -95,19 +118,217 @@ func main() {
 					Usage:   "Kubernetes namespace to monitor",
 					Sources: cli.EnvVars("MY_POD_NAMESPACE"),
 				},
-				&cli.StringFlag{
+				&cli.StringSliceFlag{
 					Name:    "url",
 					Aliases: []string{"u"},
-					Value:   "http://localhost/applicationstate",
-					Usage:   "URL which receives a POST on state change",
+					Value:   []string{defaultURL},
+					Usage:   "URL which receives a POST on state change, may be repeated or comma-delimited to notify multiple URLs, or unix:///path/to/app.sock for a Unix socket",
 					Sources: cli.EnvVars("SHAWARMA_URL"),
 				},
+				&cli.StringFlag{
+					Name:    "method",
+					Value:   http.MethodPost,
+					Usage:   "HTTP method used to notify of a state change",
+					Sources: cli.EnvVars("SHAWARMA_METHOD"),
+				},
+				&cli.StringSliceFlag{
+					Name:    "header",
+					Usage:   "Header to include when notifying of a state change, ex. \"Name: value\", may be repeated",
+					Sources: cli.EnvVars("SHAWARMA_HEADERS"),
+				},
+				&cli.StringFlag{
+					Name:    "hmac-secret-file",
+					Usage:   "Path to a file containing a secret used to sign state change notifications with HMAC-SHA256",
+					Sources: cli.EnvVars("SHAWARMA_HMAC_SECRET_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "bearer-token-file",
+					Usage:   "Path to a file containing a bearer token to include with state change notifications",
+					Sources: cli.EnvVars("SHAWARMA_BEARER_TOKEN_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "payload-format",
+					Value:   jsonPayloadFormat,
+					Usage:   "Format of state change notifications (json, cloudevents, cloudevents-binary)",
+					Sources: cli.EnvVars("SHAWARMA_PAYLOAD_FORMAT"),
+				},
+				&cli.StringFlag{
+					Name:    "exec",
+					Usage:   "Command, with space-delimited arguments, to execute on state change",
+					Sources: cli.EnvVars("SHAWARMA_EXEC"),
+				},
+				&cli.IntSliceFlag{
+					Name:    "exec-permanent-exit-codes",
+					Usage:   "Exit codes from the command which indicate a failure which should not be retried",
+					Sources: cli.EnvVars("SHAWARMA_EXEC_PERMANENT_EXIT_CODES"),
+				},
+				&cli.StringFlag{
+					Name:    "signal-process",
+					Usage:   "Name of a process to signal on state change, requires shareProcessNamespace",
+					Sources: cli.EnvVars("SHAWARMA_SIGNAL_PROCESS"),
+				},
+				&cli.StringFlag{
+					Name:    "signal-pid-file",
+					Usage:   "Path to a file containing the ID of a process to signal on state change, requires shareProcessNamespace",
+					Sources: cli.EnvVars("SHAWARMA_SIGNAL_PID_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "signal-active",
+					Value:   "SIGUSR1",
+					Usage:   "Signal sent to the process when activated",
+					Sources: cli.EnvVars("SHAWARMA_SIGNAL_ACTIVE"),
+				},
+				&cli.StringFlag{
+					Name:    "signal-inactive",
+					Value:   "SIGUSR2",
+					Usage:   "Signal sent to the process when deactivated",
+					Sources: cli.EnvVars("SHAWARMA_SIGNAL_INACTIVE"),
+				},
+				&cli.StringFlag{
+					Name:    "targets-file",
+					Usage:   "Path to a YAML or JSON file listing URLs or commands to notify on state change, with per-target settings",
+					Sources: cli.EnvVars("SHAWARMA_TARGETS_FILE"),
+				},
 				&cli.BoolFlag{
 					Name:    "disable-notifier",
 					Aliases: []string{"d"},
 					Usage:   "Enable/Disable state change notification",
 					Sources: cli.EnvVars("SHAWARMA_DISABLE_STATE_NOTIFIER"),
 				},
+				&cli.DurationFlag{
+					Name:    "notify-timeout",
+					Value:   10 * time.Second,
+					Usage:   "Timeout for each attempt to notify of a state change",
+					Sources: cli.EnvVars("SHAWARMA_NOTIFY_TIMEOUT"),
+				},
+				&cli.DurationFlag{
+					Name:    "resend-interval",
+					Usage:   "Interval at which the current state is resent even if unchanged, or 0 to only notify on change",
+					Sources: cli.EnvVars("SHAWARMA_RESEND_INTERVAL"),
+				},
+				&cli.StringFlag{
+					Name:    "endpoint-policy",
+					Usage:   "Endpoint conditions which determine the state, ready or serving to report terminating pods which are still serving as draining",
+					Value:   endpointPolicyReady,
+					Sources: cli.EnvVars("SHAWARMA_ENDPOINT_POLICY"),
+				},
+				&cli.DurationFlag{
+					Name:    "activate-delay",
+					Usage:   "Time the pod must remain in the service before it is activated",
+					Sources: cli.EnvVars("SHAWARMA_ACTIVATE_DELAY"),
+				},
+				&cli.DurationFlag{
+					Name:    "deactivate-delay",
+					Usage:   "Time the pod must remain out of the service before it is deactivated",
+					Sources: cli.EnvVars("SHAWARMA_DEACTIVATE_DELAY"),
+				},
+				&cli.IntFlag{
+					Name:    "retry-max-attempts",
+					Value:   defaultRetryPolicy.MaxAttempts,
+					Usage:   "Maximum number of attempts to notify of a state change, or 0 to retry until successful",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_MAX_ATTEMPTS"),
+				},
+				&cli.DurationFlag{
+					Name:    "retry-initial-interval",
+					Value:   defaultRetryPolicy.InitialInterval,
+					Usage:   "Delay before the first retry of a failed notification",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_INITIAL_INTERVAL"),
+				},
+				&cli.DurationFlag{
+					Name:    "retry-max-interval",
+					Value:   defaultRetryPolicy.MaxInterval,
+					Usage:   "Maximum delay between retries of a failed notification, or 0 for no maximum",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_MAX_INTERVAL"),
+				},
+				&cli.FloatFlag{
+					Name:    "retry-multiplier",
+					Value:   defaultRetryPolicy.Multiplier,
+					Usage:   "Factor by which the delay between retries is increased after each retry",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_MULTIPLIER"),
+				},
+				&cli.FloatFlag{
+					Name:    "retry-jitter",
+					Value:   defaultRetryPolicy.Jitter,
+					Usage:   "Fraction of the delay between retries, from 0 to 1, which is randomized",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_JITTER"),
+				},
+				&cli.DurationFlag{
+					Name:    "retry-deadline",
+					Usage:   "Maximum total time spent notifying of a state change, including retries, or 0 for no deadline",
+					Sources: cli.EnvVars("SHAWARMA_RETRY_DEADLINE"),
+				},
+				&cli.StringFlag{
+					Name:    "pod-condition",
+					Usage:   "Pod condition type to set on the pod status when active, ex. \"shawarma.centeredge.io/active\"",
+					Sources: cli.EnvVars("SHAWARMA_POD_CONDITION"),
+				},
+				&cli.StringFlag{
+					Name:    "state-label",
+					Usage:   "Pod label to set to the current status, ex. \"shawarma.centeredge.io/state\"",
+					Sources: cli.EnvVars("SHAWARMA_STATE_LABEL"),
+				},
+				&cli.StringFlag{
+					Name:    "state-annotation",
+					Usage:   "Pod annotation to set to the active services as JSON, ex. \"shawarma.centeredge.io/active-services\"",
+					Sources: cli.EnvVars("SHAWARMA_STATE_ANNOTATION"),
+				},
+				&cli.StringFlag{
+					Name:    "state-file",
+					Usage:   "Path of a file to which the current state is written as JSON, such as in a shared volume",
+					Sources: cli.EnvVars("SHAWARMA_STATE_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "marker-file",
+					Usage:   "Path of a file to which the current status (active or inactive) is written as plain text",
+					Sources: cli.EnvVars("SHAWARMA_MARKER_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "override-token-file",
+					Usage:   "Path of a file containing the bearer token required to override the state via /override, which is disabled if not set",
+					Sources: cli.EnvVars("SHAWARMA_OVERRIDE_TOKEN_FILE"),
+				},
+				&cli.StringFlag{
+					Name:    "override-configmap",
+					Usage:   "Name of a ConfigMap in the namespace with rules which override the state of matching pods",
+					Sources: cli.EnvVars("SHAWARMA_OVERRIDE_CONFIGMAP"),
+				},
+				&cli.BoolFlag{
+					Name:    "sharding",
+					Usage:   "Include the pod's index and count among the ready pods in the active services in the state",
+					Sources: cli.EnvVars("SHAWARMA_SHARDING"),
+				},
+				&cli.IntFlag{
+					Name:    "shard-partitions",
+					Usage:   "Number of partitions to assign among the ready pods using rendezvous hashing, implies --sharding, or 0 to disable",
+					Sources: cli.EnvVars("SHAWARMA_SHARD_PARTITIONS"),
+				},
+				&cli.BoolFlag{
+					Name:    "singleton",
+					Usage:   "Only report active while holding a Lease, so that only one pod in the services is active",
+					Sources: cli.EnvVars("SHAWARMA_SINGLETON"),
+				},
+				&cli.StringFlag{
+					Name:    "singleton-lease",
+					Usage:   "Name of the Lease used by --singleton, defaults to shawarma-<service>",
+					Sources: cli.EnvVars("SHAWARMA_SINGLETON_LEASE"),
+				},
+				&cli.BoolFlag{
+					Name:    "record-events",
+					Usage:   "Record Kubernetes events on the pod when it is activated or deactivated or a notification fails",
+					Sources: cli.EnvVars("SHAWARMA_RECORD_EVENTS"),
+				},
+				&cli.IntFlag{
+					Name:    "liveness-max-restarts",
+					Value:   5,
+					Usage:   "Number of consecutive failures to list when restarting the watch before /livez fails, or 0 for no limit",
+					Sources: cli.EnvVars("SHAWARMA_LIVENESS_MAX_RESTARTS"),
+				},
+				&cli.DurationFlag{
+					Name:    "liveness-max-disconnect",
+					Value:   5 * time.Minute,
+					Usage:   "Time the watch on the Kubernetes API may fail before /livez fails, or 0 for no limit",
+					Sources: cli.EnvVars("SHAWARMA_LIVENESS_MAX_DISCONNECT"),
+				},
 				&cli.Uint16Flag{
 					Name:    "listen-port",
 					Aliases: []string{"l"},
@@ -115,6 +336,11 @@ func main() {
 					Usage:   "Default port to be used to start the http server",
 					Sources: cli.EnvVars("SHAWARMA_LISTEN_PORT"),
 				},
+				&cli.StringFlag{
+					Name:    "listen-socket",
+					Usage:   "Path of a Unix domain socket for the http server to listen on instead of the port",
+					Sources: cli.EnvVars("SHAWARMA_LISTEN_SOCKET"),
+				},
 			},
 			Action: func(ctx context.Context, c *cli.Command) error {
 				config := MonitorConfig{
@@ -122,25 +348,80 @@ func main() {
 					PodName:              c.String("pod"),
 					ServiceName:          c.String("service"),
 					ServiceLabelSelector: c.String("service-labels"),
-					URL:                  c.String("url"),
 					DisableStateNotifier: c.Bool("disable-notifier"),
+					ResendInterval:       c.Duration("resend-interval"),
+					EndpointPolicy:       c.String("endpoint-policy"),
+					ActivateDelay:        c.Duration("activate-delay"),
+					DeactivateDelay:      c.Duration("deactivate-delay"),
 					PathToConfig:         c.String("kubeconfig"),
+					PodConditionType:     c.String("pod-condition"),
+					StateLabel:           c.String("state-label"),
+					StateAnnotation:      c.String("state-annotation"),
+					StateFile:            c.String("state-file"),
+					MarkerFile:           c.String("marker-file"),
+					OverrideTokenFile:    c.String("override-token-file"),
+					OverrideConfigMap:    c.String("override-configmap"),
+					Sharding:             c.Bool("sharding") || c.Int("shard-partitions") > 0,
+					ShardPartitions:      c.Int("shard-partitions"),
+					RecordEvents:         c.Bool("record-events"),
+					PodUID:               types.UID(c.String("pod-uid")),
+					MaxRestarts:          c.Int("liveness-max-restarts"),
+					MaxWatchDisconnect:   c.Duration("liveness-max-disconnect"),
 				}
 
-				if config.ServiceName == "" && config.ServiceLabelSelector == "" {
+				config.RolloutActiveService = c.String("rollout-active-service")
+				config.RolloutPreviewService = c.String("rollout-preview-service")
+
+				if config.RolloutActiveService != "" {
+					if config.ServiceName != "" || config.ServiceLabelSelector != "" {
+						return cli.Exit("The service name or labels may not be supplied with the rollout services", 1)
+					}
+					for _, serviceName := range []string{config.RolloutActiveService, config.RolloutPreviewService} {
+						if errs := validation.IsDNS1035Label(serviceName); serviceName != "" && len(errs) > 0 {
+							return cli.Exit("Invalid rollout service "+serviceName+": "+strings.Join(errs, ", "), 1)
+						}
+					}
+				} else if config.RolloutPreviewService != "" {
+					return cli.Exit("The rollout active service must be supplied with the preview service", 1)
+				} else if config.ServiceName == "" && config.ServiceLabelSelector == "" {
 					return cli.Exit("The service name or labels must be supplied", 1)
 				}
-
-				// In case of empty environment variable, pull default here too
-				if config.URL == "" {
-					config.URL = "http://localhost/applicationstate"
+				if config.EndpointPolicy != endpointPolicyReady && config.EndpointPolicy != endpointPolicyServing {
+					return cli.Exit("The endpoint policy must be ready or serving", 1)
+				}
+				if config.ShardPartitions < 0 {
+					return cli.Exit("The number of shard partitions must not be negative", 1)
+				}
+				if c.Bool("singleton") {
+					config.SingletonLease = c.String("singleton-lease")
+					if config.SingletonLease == "" {
+						serviceName := config.ServiceName
+						if serviceName == "" {
+							serviceName = config.RolloutActiveService
+						}
+						if serviceName == "" {
+							return cli.Exit("The singleton lease name must be supplied when using service labels", 1)
+						}
+						config.SingletonLease = "shawarma-" + serviceName
+					}
+				}
+				for _, key := range []string{config.StateLabel, config.StateAnnotation} {
+					if errs := validation.IsQualifiedName(key); key != "" && len(errs) > 0 {
+						return cli.Exit(fmt.Sprintf("Invalid label or annotation %q: %s", key, strings.Join(errs, ", ")), 1)
+					}
 				}
 
-				// Start server in a Go routine thread
-				go httpServer(c.Uint16("listen-port"), logger)
+				notifiers, err := notifierConfigs(c)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				config.Notifiers = notifiers
 
 				monitor := NewMonitor(config, logger)
 
+				// Start server in a Go routine thread
+				go httpServer(c.Uint16("listen-port"), c.String("listen-socket"), &monitor, logger)
+
 				term := make(chan os.Signal, 1)
 				signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
 
@@ -161,3 +442,97 @@ func main() {
 			zap.Error(err))
 	}
 }
+
+// Builds the notifier configuration for each target from the command line flags and targets file
+func notifierConfigs(c *cli.Command) ([]NotifierConfig, error) {
+	headers, err := parseHeaders(c.StringSlice("header"))
+	if err != nil {
+		return nil, err
+	}
+
+	payloadFormat := c.String("payload-format")
+	if err := validatePayloadFormat(payloadFormat); err != nil {
+		return nil, err
+	}
+
+	defaults := NotifierConfig{
+		Method:  c.String("method"),
+		Headers: headers,
+		Timeout: c.Duration("notify-timeout"),
+		Retry: RetryPolicy{
+			MaxAttempts:     c.Int("retry-max-attempts"),
+			InitialInterval: c.Duration("retry-initial-interval"),
+			MaxInterval:     c.Duration("retry-max-interval"),
+			Multiplier:      c.Float("retry-multiplier"),
+			Jitter:          c.Float("retry-jitter"),
+			Deadline:        c.Duration("retry-deadline"),
+		},
+		HMACSecretFile:  c.String("hmac-secret-file"),
+		BearerTokenFile: c.String("bearer-token-file"),
+		PayloadFormat:   payloadFormat,
+
+		PermanentExitCodes: c.IntSlice("exec-permanent-exit-codes"),
+	}
+
+	notifiers := []NotifierConfig{}
+
+	signalTarget := &SignalTarget{
+		ProcessName:    c.String("signal-process"),
+		PIDFile:        c.String("signal-pid-file"),
+		ActiveSignal:   c.String("signal-active"),
+		InactiveSignal: c.String("signal-inactive"),
+	}
+	hasSignal := signalTarget.ProcessName != "" || signalTarget.PIDFile != ""
+	if hasSignal {
+		// Only validated when used, signals are not supported on all platforms
+		if err := validateSignalTarget(signalTarget); err != nil {
+			return nil, err
+		}
+	}
+
+	// When a targets file, command, or signal is supplied, only include URLs from the command line if explicitly set
+	targetsFile := c.String("targets-file")
+	command := strings.Fields(c.String("exec"))
+	if (targetsFile == "" && len(command) == 0 && !hasSignal) || c.IsSet("url") {
+		for _, url := range c.StringSlice("url") {
+			url = strings.TrimSpace(url)
+			if url == "" {
+				continue
+			}
+
+			notifier := defaults
+			notifier.URL = url
+			notifiers = append(notifiers, notifier)
+		}
+	}
+
+	if len(command) > 0 {
+		notifier := defaults
+		notifier.Command = command
+		notifiers = append(notifiers, notifier)
+	}
+
+	if hasSignal {
+		notifier := defaults
+		notifier.Signal = signalTarget
+		notifiers = append(notifiers, notifier)
+	}
+
+	if targetsFile != "" {
+		targets, err := loadTargetsFile(targetsFile, defaults)
+		if err != nil {
+			return nil, fmt.Errorf("error loading targets file %s: %w", targetsFile, err)
+		}
+
+		notifiers = append(notifiers, targets...)
+	}
+
+	// In case of empty environment variable, pull default here too
+	if len(notifiers) == 0 && targetsFile == "" && len(command) == 0 && !hasSignal {
+		notifier := defaults
+		notifier.URL = defaultURL
+		notifiers = append(notifiers, notifier)
+	}
+
+	return notifiers, nil
+}
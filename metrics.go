@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "shawarma"
+
+var (
+	activeGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active",
+		Help:      "Whether the pod is currently active (1) or inactive (0).",
+	})
+
+	activeServicesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "active_services",
+		Help:      "Number of monitored services which currently include the pod.",
+	})
+
+	stateTransitionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "state_transitions_total",
+		Help:      "Number of state transitions, by the new status.",
+	}, []string{"status"})
+
+	endpointSliceEventsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "endpointslice_events_total",
+		Help:      "Number of EndpointSlice events processed, by event type.",
+	}, []string{"event"})
+
+	notificationAttemptsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notification_attempts_total",
+		Help:      "Number of attempts to notify the application of a state change, by target.",
+	}, []string{"target"})
+
+	notificationFailuresCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notification_failures_total",
+		Help:      "Number of failed attempts to notify the application of a state change, by target.",
+	}, []string{"target"})
+
+	notificationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "notification_duration_seconds",
+		Help:      "Duration of attempts to notify the application of a state change, by target.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"target"})
+
+	controllerRestartsCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "controller_restarts_total",
+		Help:      "Number of times the EndpointSlice controller exited unexpectedly and was restarted.",
+	})
+)
+
+const (
+	endpointSliceAddedEvent   = "add"
+	endpointSliceUpdatedEvent = "update"
+	endpointSliceDeletedEvent = "delete"
+)
+
+var endpointSliceCacheSlicesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, "endpointslice_cache", "slices"),
+	"Number of EndpointSlices in the cache, by service.",
+	[]string{"namespace", "service"},
+	nil)
+
+var endpointSliceCacheEndpointsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, "endpointslice_cache", "endpoints"),
+	"Number of endpoints in the cache, by service.",
+	[]string{"namespace", "service"},
+	nil)
+
+// Collects the size of an EndpointSliceCache at scrape time
+type endpointSliceCacheCollector struct {
+	cache *EndpointSliceCache
+}
+
+func (collector endpointSliceCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- endpointSliceCacheSlicesDesc
+	ch <- endpointSliceCacheEndpointsDesc
+}
+
+func (collector endpointSliceCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.cache.lock.Lock()
+	defer collector.cache.lock.Unlock()
+
+	for serviceName, tracker := range collector.cache.trackerByServiceMap {
+		endpoints := 0
+		for _, slice := range tracker.slices {
+			endpoints += len(slice.Endpoints)
+		}
+
+		ch <- prometheus.MustNewConstMetric(endpointSliceCacheSlicesDesc, prometheus.GaugeValue,
+			float64(len(tracker.slices)), serviceName.Namespace, serviceName.Name)
+		ch <- prometheus.MustNewConstMetric(endpointSliceCacheEndpointsDesc, prometheus.GaugeValue,
+			float64(endpoints), serviceName.Namespace, serviceName.Name)
+	}
+}
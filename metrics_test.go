@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEndpointSliceCacheCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := NewEndpointSliceCache()
+	cache.Update(&discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "svc-abc",
+			Labels:    map[string]string{discovery.LabelServiceName: "svc"},
+		},
+		Endpoints: []discovery.Endpoint{{}, {}},
+	}, false)
+
+	expected := `
+# HELP shawarma_endpointslice_cache_endpoints Number of endpoints in the cache, by service.
+# TYPE shawarma_endpointslice_cache_endpoints gauge
+shawarma_endpointslice_cache_endpoints{namespace="default",service="svc"} 2
+# HELP shawarma_endpointslice_cache_slices Number of EndpointSlices in the cache, by service.
+# TYPE shawarma_endpointslice_cache_slices gauge
+shawarma_endpointslice_cache_slices{namespace="default",service="svc"} 1
+`
+
+	err := testutil.CollectAndCompare(endpointSliceCacheCollector{cache}, strings.NewReader(expected))
+	assert.Nil(err)
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"reflect"
 	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	discovery "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -19,13 +25,66 @@ type Monitor struct {
 	Config MonitorConfig
 	Logger *zap.Logger
 
-	cache *EndpointSliceCache
+	cache     *EndpointSliceCache
+	clientset kubernetes.Interface
 
 	stop          chan struct{}
 	stopRequested bool
 
-	state       monitorState
-	stateChange chan monitorState
+	// stateLock protects state and sends to stateChange, so states are published in order
+	stateLock         sync.Mutex
+	state             monitorState
+	stateChange       chan monitorState
+	stateChangeClosed bool
+	// True once a state has been published, after which processStateChange writes the state files
+	statePublished bool
+
+	// Services which currently include the pod, which may not yet be reflected in state
+	observedServiceNames []types.NamespacedName
+	// Services in which the pod is terminating but still serving, if EndpointPolicy is serving
+	observedDrainingServiceNames []types.NamespacedName
+	// Status of the pod's endpoint in each service which includes it, and the cause of the last change
+	observedEndpointStatuses map[types.NamespacedName]string
+	observedReason           string
+	// Sorted names of the ready pods in the services which include the pod as active, if Sharding is set
+	observedShardPods []string
+	// Pod template hash of the pod, and selected by each rollout service, if RolloutActiveService is set
+	rolloutPodHash       string
+	rolloutServiceHashes map[string]string
+	// Timer which applies an activation or deactivation once the delay has elapsed
+	pendingTransition *time.Timer
+	// Status set manually via the override endpoint, nil if not overridden
+	override *stateOverride
+	// Rules from the override ConfigMap which may apply to the pod, in order of precedence
+	configMapRules []configMapOverrideRule
+	// overrideLock serializes changes to the override ConfigMap and the labels of the pod it is
+	// matched against, nil until known
+	overrideLock      sync.Mutex
+	overrideConfigMap *corev1.ConfigMap
+	overridePodLabels labels.Set
+
+	// True while the pod holds the singleton lease, if SingletonLease is set
+	leaseHeld bool
+	// Receives whether the pod should campaign for the singleton lease, and the last value sent
+	singletonEligible chan bool
+	singletonSignaled bool
+
+	// Last condition status, reason and transition time written to the pod, if PodConditionType is set
+	podConditionStatus corev1.ConditionStatus
+	podConditionReason string
+	podConditionTime   metav1.Time
+	// Retries a failed patch of the pod condition until it succeeds or a later state supersedes it
+	podConditionRetrier podPatchRetrier
+	// Last patch applied to the pod's labels and annotations, if StateLabel or StateAnnotation is set
+	podMetadataPatch []byte
+	// Retries a failed patch of the pod's labels and annotations until it succeeds or a later state supersedes it
+	podMetadataRetrier podPatchRetrier
+
+	notifiers []*notifier
+
+	health *watchHealth
+	// Records events against the pod, nil if disabled
+	events *podEventRecorder
 }
 
 type MonitorConfig struct {
@@ -33,16 +92,78 @@ type MonitorConfig struct {
 	PodName              string
 	ServiceName          string
 	ServiceLabelSelector string
-	URL                  string
+	Notifiers            []NotifierConfig
 	PathToConfig         string
 	DisableStateNotifier bool
+	ResendInterval       time.Duration
+	// Endpoint conditions used to determine if the pod is active, ready (default) or serving
+	EndpointPolicy string
+	// Time the pod must remain in or out of the services before it is activated or deactivated
+	ActivateDelay   time.Duration
+	DeactivateDelay time.Duration
+	// Pod condition type to maintain on the pod status, empty to disable
+	PodConditionType string
+	// Pod label set to the status and annotation set to the active services, empty to disable
+	StateLabel      string
+	StateAnnotation string
+	// Paths of files to which the state JSON and the plain status are written, empty to disable
+	StateFile  string
+	MarkerFile string
+	// File containing the bearer token required by the override endpoint, empty to disable overrides
+	OverrideTokenFile string
+	// Name of a ConfigMap in the namespace with rules to override the state, empty to disable
+	OverrideConfigMap string
+	// Name of a Lease which the pod must hold to be active, so only one pod is active, empty to disable
+	SingletonLease string
+	// Argo Rollouts services used instead of ServiceName, the pod is preview if only in the preview service
+	RolloutActiveService  string
+	RolloutPreviewService string
+	// Publish the pod's position among the ready pods, and assign this many partitions if not 0
+	Sharding        bool
+	ShardPartitions int
+	// Record Kubernetes events against the pod, whose UID is looked up if not supplied
+	RecordEvents bool
+	PodUID       types.UID
+	// Thresholds above which the sidecar is reported as not live, 0 for no limit
+	MaxRestarts        int
+	MaxWatchDisconnect time.Duration
 }
 
+const (
+	// Only ready endpoints are active
+	endpointPolicyReady = "ready"
+	// Serving endpoints are active, or draining if they are also terminating
+	endpointPolicyServing = "serving"
+)
+
+// Reasons for a change in state
+const (
+	endpointAddedReason       = "EndpointAdded"
+	endpointRemovedReason     = "EndpointRemoved"
+	endpointReadyReason       = "EndpointReady"
+	endpointUnreadyReason     = "EndpointUnready"
+	endpointTerminatingReason = "EndpointTerminating"
+	// Change found when relisting after the watch was dropped, which was missed while disconnected
+	watchResyncReason = "WatchResync"
+)
+
 // Tracks the current state
 type monitorState struct {
-	isActive bool
-	// List of endpoints known to be active, when empty this means we should deactivate the application
+	// One of activeStatus, inactiveStatus, drainingStatus or previewStatus
+	status string
+	// List of endpoints known to be active, or draining if the status is draining
 	serviceNames []types.NamespacedName
+	// Cause of the change and the time it was applied
+	reason string
+	time   time.Time
+	// True if the status was set manually, regardless of the endpoints
+	overridden bool
+	// Position among the ready pods if active and Sharding is set, otherwise nil
+	shard *shardAssignment
+}
+
+func (state monitorState) isActive() bool {
+	return state.status == activeStatus
 }
 
 func (config *MonitorConfig) CreateChildLogger(logger *zap.Logger) *zap.Logger {
@@ -58,45 +179,204 @@ func (config *MonitorConfig) CreateChildLogger(logger *zap.Logger) *zap.Logger {
 	if len(config.ServiceLabelSelector) > 0 {
 		fields = append(fields, zap.String("lbl", config.ServiceLabelSelector))
 	}
+	if len(config.RolloutActiveService) > 0 {
+		fields = append(fields, zap.String("svc", config.RolloutActiveService))
+	}
 
 	return logger.With(fields...)
 }
 
 func NewMonitor(config MonitorConfig, logger *zap.Logger) Monitor {
+	notifiers := make([]*notifier, 0, len(config.Notifiers))
+	for _, notifierConfig := range config.Notifiers {
+		// Identify the pod and service in CloudEvents
+		if notifierConfig.EventSource == "" {
+			notifierConfig.EventSource = "/namespaces/" + config.Namespace + "/pods/" + config.PodName
+		}
+		if notifierConfig.EventSubject == "" {
+			if config.ServiceName != "" {
+				notifierConfig.EventSubject = config.ServiceName
+			} else if config.RolloutActiveService != "" {
+				notifierConfig.EventSubject = config.RolloutActiveService
+			} else {
+				notifierConfig.EventSubject = config.ServiceLabelSelector
+			}
+		}
+
+		notifiers = append(notifiers, newNotifier(notifierConfig))
+	}
+
 	return Monitor{
 		Config: config,
 		Logger: logger,
 		cache:  NewEndpointSliceCache(),
+		state:  monitorState{status: inactiveStatus},
+		// Created up front so overrides received before Start are published once it begins, holding
+		// only the latest state
+		stateChange: make(chan monitorState, 1),
+		// Buffers the latest eligibility, the singleton is only run if SingletonLease is set
+		singletonEligible: make(chan bool, 1),
+		notifiers:         notifiers,
+		health:            newWatchHealth(config.MaxRestarts, config.MaxWatchDisconnect),
 	}
 }
 
-func (monitor *Monitor) processEndpointSlice(endpointSlice *discovery.EndpointSlice, remove bool) {
+// Updates the cache with the endpoint slice and reconciles the state. Resync indicates the
+// change was found when relisting after the watch was dropped.
+func (monitor *Monitor) processEndpointSlice(endpointSlice *discovery.EndpointSlice, remove bool, resync bool) {
 	changed := monitor.cache.Update(endpointSlice, remove)
 	if !changed {
 		// No change in the cache, nothing to do
 		return
 	}
 
+	endpointStatuses := map[types.NamespacedName]string{}
 	serviceNames := []types.NamespacedName{}
+	drainingServiceNames := []types.NamespacedName{}
+	shardPods := []string{}
 
 	for serviceName, endpoints := range monitor.cache.Services() {
+		// Ready pods in the service, only included in the shard if the pod is active in the service
+		var readyPods []string
+
 		for endpoint := range endpoints {
-			// Per spec, ready being nil means ready
-			if (endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready) &&
-				endpoint.TargetRef != nil {
+			if endpoint.TargetRef == nil ||
+				endpoint.TargetRef.Kind != "Pod" ||
+				endpoint.TargetRef.Namespace != monitor.Config.Namespace {
+				continue
+			}
 
-				if endpoint.TargetRef.Kind == "Pod" &&
-					endpoint.TargetRef.Namespace == monitor.Config.Namespace &&
-					endpoint.TargetRef.Name == monitor.Config.PodName {
+			status := monitor.endpointStatus(endpoint.Conditions)
+			if monitor.Config.Sharding && status == activeStatus {
+				readyPods = append(readyPods, endpoint.TargetRef.Name)
+			}
 
-					serviceNames = append(serviceNames, serviceName)
-					break
+			if endpoint.TargetRef.Name == monitor.Config.PodName {
+				// The pod may have an endpoint in more than one slice, such as when dual-stack, and the
+				// slices are in no particular order, so use the best status of any of them
+				if previous, ok := endpointStatuses[serviceName]; !ok || endpointStatusRank(status) > endpointStatusRank(previous) {
+					endpointStatuses[serviceName] = status
 				}
 			}
 		}
+
+		if endpointStatuses[serviceName] == activeStatus {
+			shardPods = append(shardPods, readyPods...)
+		}
+	}
+
+	// Built from the statuses, so each service is listed once even if the pod has many endpoints
+	for serviceName, status := range endpointStatuses {
+		switch status {
+		case activeStatus:
+			serviceNames = append(serviceNames, serviceName)
+		case drainingStatus:
+			drainingServiceNames = append(drainingServiceNames, serviceName)
+		}
 	}
 
 	// Sort service names to have a consistent order
+	sortServiceNames(serviceNames)
+	sortServiceNames(drainingServiceNames)
+
+	// A pod may be ready in more than one of the services
+	slices.Sort(shardPods)
+	shardPods = slices.Compact(shardPods)
+
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	if reason := endpointChangeReason(monitor.observedEndpointStatuses, endpointStatuses); reason != "" {
+		if resync {
+			reason = watchResyncReason
+		}
+		monitor.observedReason = reason
+	} else if !slices.Equal(monitor.observedShardPods, shardPods) {
+		monitor.observedReason = shardMembersChangedReason
+	}
+
+	monitor.observedShardPods = shardPods
+	monitor.observedEndpointStatuses = endpointStatuses
+	monitor.observedServiceNames = serviceNames
+	monitor.observedDrainingServiceNames = drainingServiceNames
+	monitor.reconcileLocked()
+}
+
+// Describes the change to the pod's endpoint status, using the first changed service in
+// sorted order, or returns empty if unchanged
+func endpointChangeReason(previous, current map[types.NamespacedName]string) string {
+	serviceNames := make([]types.NamespacedName, 0, len(previous)+len(current))
+	for serviceName := range previous {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	for serviceName := range current {
+		if _, ok := previous[serviceName]; !ok {
+			serviceNames = append(serviceNames, serviceName)
+		}
+	}
+	sortServiceNames(serviceNames)
+
+	for _, serviceName := range serviceNames {
+		previousStatus, existed := previous[serviceName]
+		currentStatus, exists := current[serviceName]
+
+		switch {
+		case !exists:
+			return endpointRemovedReason
+		case currentStatus == previousStatus:
+			continue
+		case !existed:
+			return endpointAddedReason
+		case currentStatus == activeStatus:
+			return endpointReadyReason
+		case currentStatus == drainingStatus:
+			return endpointTerminatingReason
+		default:
+			return endpointUnreadyReason
+		}
+	}
+
+	return ""
+}
+
+// Returns the status of the pod within a service based on the conditions of its endpoint
+func (monitor *Monitor) endpointStatus(conditions discovery.EndpointConditions) string {
+	if monitor.Config.EndpointPolicy != endpointPolicyServing {
+		// Per spec, ready being nil means ready
+		if conditions.Ready == nil || *conditions.Ready {
+			return activeStatus
+		}
+		return inactiveStatus
+	}
+
+	// Per spec, serving being nil falls back to ready
+	serving := conditions.Serving
+	if serving == nil {
+		serving = conditions.Ready
+	}
+	if serving != nil && !*serving {
+		return inactiveStatus
+	}
+
+	if conditions.Terminating != nil && *conditions.Terminating {
+		return drainingStatus
+	}
+	return activeStatus
+}
+
+// Ranks endpoint statuses, active being the best
+func endpointStatusRank(status string) int {
+	switch status {
+	case activeStatus:
+		return 2
+	case drainingStatus:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func sortServiceNames(serviceNames []types.NamespacedName) {
 	slices.SortFunc(serviceNames, func(a, b types.NamespacedName) int {
 		if a.Namespace < b.Namespace {
 			return -1
@@ -110,29 +390,257 @@ func (monitor *Monitor) processEndpointSlice(endpointSlice *discovery.EndpointSl
 			return 0
 		}
 	})
+}
+
+// Computes the state the pod should be in based on the latest observations.
+// Must be called while holding stateLock.
+func (monitor *Monitor) desiredStateLocked() monitorState {
+	// Overrides for the individual pod take precedence over the ConfigMap
+	if monitor.override != nil {
+		return monitor.overriddenStateLocked(monitor.override.status, overrideReason)
+	}
+	if rule := monitor.configMapOverrideLocked(); rule != nil {
+		return monitor.overriddenStateLocked(rule.status, configMapOverrideReason)
+	}
+
+	state := monitor.endpointStateLocked()
+	if monitor.Config.SingletonLease != "" && state.isActive() && !monitor.leaseHeld {
+		// Another pod is active
+		return monitorState{
+			status:       inactiveStatus,
+			serviceNames: []types.NamespacedName{},
+			reason:       monitor.observedReason,
+		}
+	}
+
+	return state
+}
+
+// Computes the state based only on the endpoints. Must be called while holding stateLock.
+func (monitor *Monitor) endpointStateLocked() monitorState {
+	if monitor.Config.RolloutActiveService != "" {
+		return monitor.rolloutStateLocked()
+	}
+
+	if len(monitor.observedServiceNames) > 0 {
+		return monitorState{
+			status:       activeStatus,
+			serviceNames: monitor.observedServiceNames,
+			reason:       monitor.observedReason,
+			shard:        monitor.shardAssignmentLocked(activeStatus),
+		}
+	}
+	if len(monitor.observedDrainingServiceNames) > 0 {
+		return monitorState{
+			status:       drainingStatus,
+			serviceNames: monitor.observedDrainingServiceNames,
+			reason:       monitor.observedReason,
+		}
+	}
+
+	return monitorState{
+		status:       inactiveStatus,
+		serviceNames: monitor.observedServiceNames,
+		reason:       monitor.observedReason,
+	}
+}
+
+// Returns the state with the status overridden. Must be called while holding stateLock.
+func (monitor *Monitor) overriddenStateLocked(status string, reason string) monitorState {
+	if status == frozenOverrideStatus {
+		// Keep the current status and services
+		frozen := monitor.state
+		if !frozen.overridden {
+			frozen.reason = reason
+			frozen.overridden = true
+		}
+		return frozen
+	}
+
+	serviceNames := []types.NamespacedName{}
+	if status == activeStatus {
+		serviceNames = monitor.observedServiceNames
+	}
+
+	return monitorState{
+		status:       status,
+		serviceNames: serviceNames,
+		reason:       reason,
+		overridden:   true,
+		shard:        monitor.shardAssignmentLocked(status),
+	}
+}
+
+// Moves towards the desired state, delaying activation or deactivation if configured.
+// Must be called while holding stateLock.
+func (monitor *Monitor) reconcileLocked() {
+	// Only pods which are active in the services campaign for the singleton lease
+	monitor.signalSingletonLocked(monitor.endpointStateLocked().isActive())
 
-	if reflect.DeepEqual(serviceNames, monitor.state.serviceNames) {
-		// No change in the list of services, nothing to do
+	desired := monitor.desiredStateLocked()
+
+	if desired.status == monitor.state.status {
+		if monitor.pendingTransition != nil {
+			// Flipped back before the delay elapsed
+			monitor.Config.CreateChildLogger(monitor.Logger).Info("Pending transition cancelled")
+			monitor.pendingTransition.Stop()
+			monitor.pendingTransition = nil
+		}
+
+		if reflect.DeepEqual(desired.serviceNames, monitor.state.serviceNames) &&
+			desired.overridden == monitor.state.overridden &&
+			reflect.DeepEqual(desired.shard, monitor.state.shard) {
+			// No change in the list of services or shard, nothing to do
+			return
+		}
+
+		monitor.applyStateLocked(desired)
 		return
 	}
 
-	shouldBeActive := len(serviceNames) > 0
+	// Transitions between inactive and draining, and to or from an override, are not delayed
+	delay := time.Duration(0)
+	if !desired.overridden && !monitor.state.overridden {
+		if desired.isActive() {
+			delay = monitor.Config.ActivateDelay
+		} else if monitor.state.isActive() {
+			delay = monitor.Config.DeactivateDelay
+		}
+	}
 
-	childLogger := monitor.Config.CreateChildLogger(monitor.Logger)
-	if shouldBeActive != monitor.state.isActive {
-		monitor.state.isActive = shouldBeActive
+	if delay <= 0 {
+		if monitor.pendingTransition != nil {
+			monitor.pendingTransition.Stop()
+			monitor.pendingTransition = nil
+		}
+
+		monitor.applyStateLocked(desired)
+		return
+	}
+
+	if monitor.pendingTransition != nil {
+		// Already waiting for the condition to hold
+		return
+	}
 
-		if shouldBeActive {
+	monitor.Config.CreateChildLogger(monitor.Logger).Info("Transition pending",
+		zap.String("status", desired.status),
+		zap.Duration("delay", delay))
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		monitor.stateLock.Lock()
+		defer monitor.stateLock.Unlock()
+
+		if monitor.pendingTransition != timer {
+			// Cancelled after the timer fired
+			return
+		}
+		monitor.pendingTransition = nil
+
+		// The condition has held for the full delay, apply it along with the latest services
+		desired := monitor.desiredStateLocked()
+		if desired.status != monitor.state.status {
+			monitor.applyStateLocked(desired)
+		}
+	})
+	monitor.pendingTransition = timer
+}
+
+// Makes the state effective and publishes it. Must be called while holding stateLock.
+func (monitor *Monitor) applyStateLocked(desired monitorState) {
+	childLogger := monitor.Config.CreateChildLogger(monitor.Logger).With(zap.String("reason", desired.reason))
+
+	services := make([]string, 0, len(desired.serviceNames))
+	for _, serviceName := range desired.serviceNames {
+		services = append(services, serviceName.String())
+	}
+	eventSuffix := ""
+	if desired.reason != "" {
+		eventSuffix = " (" + desired.reason + ")"
+	}
+
+	if desired.status != monitor.state.status {
+		switch desired.status {
+		case activeStatus:
 			childLogger.Info("Activated")
-		} else {
+			activeGauge.Set(1)
+			monitor.events.event(corev1.EventTypeNormal, activatedEventReason,
+				"Active in "+strings.Join(services, ", ")+eventSuffix)
+		case drainingStatus:
+			childLogger.Info("Draining")
+			activeGauge.Set(0)
+			monitor.events.event(corev1.EventTypeNormal, drainingEventReason,
+				"Draining from "+strings.Join(services, ", ")+eventSuffix)
+		case previewStatus:
+			childLogger.Info("Previewing")
+			activeGauge.Set(0)
+			monitor.events.event(corev1.EventTypeNormal, previewingEventReason,
+				"Previewing in "+strings.Join(services, ", ")+eventSuffix)
+		default:
 			childLogger.Info("Deactivated")
+			activeGauge.Set(0)
+			monitor.events.event(corev1.EventTypeNormal, deactivatedEventReason,
+				"Not active in any service"+eventSuffix)
 		}
-	} else {
-		childLogger.Info("Endpoints changed")
+		stateTransitionsCounter.WithLabelValues(desired.status).Inc()
+	} else if desired.overridden != monitor.state.overridden {
+		childLogger.Info("Override changed", zap.Bool("overridden", desired.overridden))
+	} else if !reflect.DeepEqual(desired.serviceNames, monitor.state.serviceNames) {
+		// The initial nil list differs from an empty list, but is not a change in the services
+		if len(desired.serviceNames) > 0 || len(monitor.state.serviceNames) > 0 {
+			childLogger.Info("Endpoints changed")
+			monitor.events.event(corev1.EventTypeNormal, endpointsChangedEventReason,
+				"Services changed to "+strings.Join(services, ", ")+eventSuffix)
+		}
+	} else if desired.shard != nil {
+		childLogger.Info("Shard changed",
+			zap.Int("index", desired.shard.index),
+			zap.Int("count", desired.shard.count))
 	}
+	activeServicesGauge.Set(float64(len(desired.serviceNames)))
 
-	monitor.state.serviceNames = serviceNames
-	monitor.stateChange <- monitor.state
+	desired.time = time.Now()
+	monitor.state = desired
+	monitor.publishStateLocked()
+}
+
+// Sends the current state to be processed, replacing any state not yet received so that a slow
+// consumer never blocks while holding stateLock. Must be called while holding stateLock.
+func (monitor *Monitor) publishStateLocked() {
+	if monitor.stateChangeClosed {
+		return
+	}
+	monitor.statePublished = true
+
+	select {
+	case monitor.stateChange <- monitor.state:
+	default:
+		select {
+		case <-monitor.stateChange:
+		default:
+		}
+		monitor.stateChange <- monitor.state
+	}
+}
+
+// Periodically republishes the current state, even if unchanged, until the monitor is stopped
+func (monitor *Monitor) resendState(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-monitor.stop:
+			return
+
+		case <-ticker.C:
+			monitor.stateLock.Lock()
+			monitor.Logger.Debug("Resending current state")
+			monitor.publishStateLocked()
+			monitor.stateLock.Unlock()
+		}
+	}
 }
 
 func (monitor *Monitor) processStateChange(state monitorState) {
@@ -141,15 +649,57 @@ func (monitor *Monitor) processStateChange(state monitorState) {
 	// Set new State
 	setStateChange(&state, childLogger)
 
+	monitor.updateStateFiles(childLogger)
+
 	// Notify if is enabled
 	if !monitor.Config.DisableStateNotifier {
-		childLogger.Debug("Posting state change notification...")
-		err := notifyStateChange(monitor.Config.URL, childLogger)
-		if err != nil {
-			childLogger.Error("Error processing state change",
-				zap.Error(err))
+		currentState := getState()
+		for _, notifier := range monitor.notifiers {
+			notifier.start(currentState, childLogger.With(zap.String("target", notifier.config.target())))
 		}
 	}
+
+	// Update the pod condition if is enabled
+	if monitor.Config.PodConditionType != "" {
+		monitor.podConditionRetrier.start(childLogger.With(zap.String("condition", monitor.Config.PodConditionType)),
+			func(ctx context.Context) error {
+				return monitor.updatePodCondition(ctx, &state)
+			})
+	}
+
+	// Update the pod label and annotation if enabled
+	if monitor.Config.StateLabel != "" || monitor.Config.StateAnnotation != "" {
+		monitor.podMetadataRetrier.start(childLogger,
+			func(ctx context.Context) error {
+				return monitor.updatePodMetadata(ctx, &state)
+			})
+	}
+}
+
+// Writes the current state to the state files, if enabled
+func (monitor *Monitor) updateStateFiles(logger *zap.Logger) {
+	if monitor.Config.StateFile == "" && monitor.Config.MarkerFile == "" {
+		return
+	}
+
+	err := writeStateFiles(monitor.Config.StateFile, monitor.Config.MarkerFile, getState())
+	if err != nil {
+		logger.Error("Error writing state files",
+			zap.Error(err))
+	}
+}
+
+// Writes the state files once the initial list has been processed if the list did not change the
+// state, so existing files are left in place until the state is known and the files exist even if
+// the pod is never active
+func (monitor *Monitor) writeSyncedStateFiles() {
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	// Otherwise written by processStateChange, holding stateLock orders this write before any later state
+	if !monitor.statePublished {
+		monitor.updateStateFiles(monitor.Config.CreateChildLogger(monitor.Logger))
+	}
 }
 
 func (monitor *Monitor) Start() error {
@@ -170,17 +720,58 @@ func (monitor *Monitor) Start() error {
 	if err != nil {
 		return err
 	}
+	monitor.clientset = clientset
+
+	// Report the size of the cache on the metrics endpoint
+	prometheus.MustRegister(endpointSliceCacheCollector{monitor.cache})
+
+	if monitor.Config.RecordEvents {
+		events, stopEvents := monitor.startEventRecorder()
+		defer stopEvents()
+
+		monitor.events = events
+		for _, notifier := range monitor.notifiers {
+			notifier.events = events
+		}
+	}
 
 	// Subscribe to state changes
-	monitor.stateChange = make(chan monitorState)
 	go func() {
 		for state := range debounce(100*time.Millisecond, monitor.stateChange) {
 			monitor.processStateChange(state)
 		}
+
+		monitor.podConditionRetrier.stop()
+		monitor.podMetadataRetrier.stop()
+	}()
+	defer func() {
+		monitor.stateLock.Lock()
+		defer monitor.stateLock.Unlock()
+
+		monitor.stateChangeClosed = true
+		close(monitor.stateChange)
 	}()
-	defer close(monitor.stateChange)
 
 	monitor.stop = make(chan struct{})
+
+	if monitor.Config.ResendInterval > 0 {
+		go monitor.resendState(monitor.Config.ResendInterval)
+	}
+	if monitor.Config.OverrideConfigMap != "" {
+		go monitor.watchOverrideConfigMap()
+	}
+	if monitor.Config.RolloutActiveService != "" {
+		go monitor.watchRolloutServices()
+	}
+	if monitor.Config.SingletonLease != "" {
+		singletonDone := make(chan struct{})
+		go monitor.runSingleton(singletonDone)
+
+		// Release the lease before exiting so another pod may take over
+		defer func() {
+			<-singletonDone
+		}()
+	}
 	for monitor.stopRequested = false; !monitor.stopRequested; {
 		watchList := cache.NewFilteredListWatchFromClient(
 			clientset.DiscoveryV1().RESTClient(),
@@ -197,13 +788,20 @@ func (monitor *Monitor) Start() error {
 					labelSelector += discovery.LabelServiceName + "=" + monitor.Config.ServiceName
 				}
 
+				if len(monitor.Config.RolloutActiveService) > 0 {
+					labelSelector = monitor.Config.rolloutLabelSelector()
+				}
+
 				options.LabelSelector = labelSelector
 			},
 		)
 
+		// Changes found when relisting after the watch is dropped are reported as a resync
+		lw := newHealthListerWatcher(watchList, monitor.health)
+
 		_, controller := cache.NewInformerWithOptions(
 			cache.InformerOptions{
-				ListerWatcher: watchList,
+				ListerWatcher: lw,
 				ObjectType:    &discovery.EndpointSlice{},
 				ResyncPeriod:  time.Second * 0,
 				Handler: cache.ResourceEventHandlerFuncs{
@@ -212,31 +810,56 @@ func (monitor *Monitor) Start() error {
 
 						monitor.Logger.Debug("endpointslice added",
 							zap.String("endpoint", endpointSlice.Name))
-						monitor.processEndpointSlice(endpointSlice, false)
+						endpointSliceEventsCounter.WithLabelValues(endpointSliceAddedEvent).Inc()
+						monitor.processEndpointSlice(endpointSlice, false, lw.isRelisted(endpointSlice))
 					},
 					DeleteFunc: func(obj interface{}) {
-						endpointSlice := obj.(*discovery.EndpointSlice)
+						// A deletion missed while the watch was dropped is found by the relist, and
+						// delivered as a tombstone
+						resync := false
+						if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+							obj = tombstone.Obj
+							resync = true
+						}
+						endpointSlice, ok := obj.(*discovery.EndpointSlice)
+						if !ok {
+							return
+						}
 
 						monitor.Logger.Debug("endpointslice deleted",
 							zap.String("endpoint", endpointSlice.Name))
-						monitor.processEndpointSlice(endpointSlice, true)
+						endpointSliceEventsCounter.WithLabelValues(endpointSliceDeletedEvent).Inc()
+						monitor.processEndpointSlice(endpointSlice, true, resync)
 					},
 					UpdateFunc: func(oldObj, newObj interface{}) {
 						endpointSlice := newObj.(*discovery.EndpointSlice)
 
 						monitor.Logger.Debug("endpointslice changed",
 							zap.String("endpoint", endpointSlice.Name))
-						monitor.processEndpointSlice(endpointSlice, false)
+						endpointSliceEventsCounter.WithLabelValues(endpointSliceUpdatedEvent).Inc()
+						monitor.processEndpointSlice(endpointSlice, false, lw.isRelisted(endpointSlice))
 					},
 				},
 			})
 
+		// Report ready once the initial list has been processed
+		controllerDone := make(chan struct{})
+		go func() {
+			if cache.WaitForCacheSync(controllerDone, controller.HasSynced) {
+				monitor.Logger.Debug("Controller synced")
+				monitor.health.setSynced()
+				monitor.writeSyncedStateFiles()
+			}
+		}()
+
 		monitor.Logger.Debug("Starting controller")
 		controller.Run(monitor.stop)
 		monitor.Logger.Debug("Controller exited")
+		close(controllerDone)
 
 		if !monitor.stopRequested {
 			monitor.Logger.Warn("Fail out of controller.Run, restarting...")
+			controllerRestartsCounter.Inc()
 		}
 	}
 
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestResendState_RepublishesCurrentState(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := NewMonitor(MonitorConfig{}, zap.NewNop())
+	monitor.stop = make(chan struct{})
+	monitor.stateChange = make(chan monitorState)
+	monitor.state = monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+	}
+
+	go monitor.resendState(10 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case state := <-monitor.stateChange:
+			assert.Equal(monitor.state, state)
+		case <-time.After(time.Second):
+			t.Fatal("expected state to be resent")
+		}
+	}
+
+	close(monitor.stop)
+}
+
+func TestPublishState_SlowConsumer_KeepsLatest(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := NewMonitor(MonitorConfig{Namespace: "default", PodName: "pod"}, zap.NewNop())
+
+	// Nothing is receiving, the changes must not block
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+
+	assert.Len(monitor.stateChange, 1)
+	assert.Equal(inactiveStatus, (<-monitor.stateChange).status)
+}
+
+func newTestMonitor(config MonitorConfig) *Monitor {
+	config.Namespace = "default"
+	config.PodName = "pod"
+	config.ServiceName = "svc"
+
+	monitor := NewMonitor(config, zap.NewNop())
+	monitor.stateChange = make(chan monitorState, 100)
+
+	return &monitor
+}
+
+func newTestEndpointSlice(serviceName string, ready bool, podNames ...string) *discovery.EndpointSlice {
+	endpoints := make([]discovery.Endpoint, 0, len(podNames))
+	for _, podName := range podNames {
+		endpoints = append(endpoints, discovery.Endpoint{
+			Conditions: discovery.EndpointConditions{
+				Ready: &ready,
+			},
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: "default",
+				Name:      podName,
+			},
+		})
+	}
+
+	return &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      serviceName + "-abc",
+			Labels:    map[string]string{discovery.LabelServiceName: serviceName},
+		},
+		Endpoints: endpoints,
+	}
+}
+
+func (monitor *Monitor) currentState() monitorState {
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	return monitor.state
+}
+
+func TestProcessEndpointSlice_Ready_Activates(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod", "other"), false, false)
+
+	assert.True(monitor.currentState().isActive())
+	assert.Equal([]types.NamespacedName{{Namespace: "default", Name: "svc"}}, monitor.currentState().serviceNames)
+	assert.Len(monitor.stateChange, 1)
+}
+
+func TestProcessEndpointSlice_NotReady_Inactive(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+
+	assert.False(monitor.currentState().isActive())
+	assert.Len(monitor.stateChange, 2)
+}
+
+func TestProcessEndpointSlice_ReadyInAnySlice_Activates(t *testing.T) {
+	assert := assert.New(t)
+
+	// Slices are visited in random order, so repeat to cover both orders
+	for range 20 {
+		monitor := newTestMonitor(MonitorConfig{})
+
+		unready := newTestEndpointSlice("svc", false, "pod")
+		unready.Name = "svc-def"
+
+		monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+		monitor.processEndpointSlice(unready, false, false)
+
+		assert.True(monitor.currentState().isActive())
+	}
+}
+
+func TestProcessEndpointSlice_ActivateDelay_DelaysActivation(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		ActivateDelay: 50 * time.Millisecond,
+	})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	assert.False(monitor.currentState().isActive())
+	assert.Len(monitor.stateChange, 0)
+
+	assert.Eventually(func() bool {
+		return monitor.currentState().isActive()
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(monitor.stateChange, 1)
+}
+
+func TestProcessEndpointSlice_DeactivateDelay_CancelledByFlipBack(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		DeactivateDelay: 100 * time.Millisecond,
+	})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	assert.True(monitor.currentState().isActive())
+
+	// Brief readiness probe failure
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+	assert.True(monitor.currentState().isActive())
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	time.Sleep(200 * time.Millisecond)
+
+	assert.True(monitor.currentState().isActive())
+	// Only the initial activation was published
+	assert.Len(monitor.stateChange, 1)
+}
+
+func TestProcessEndpointSlice_DeactivateDelay_DeactivatesAfterDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		DeactivateDelay: 50 * time.Millisecond,
+	})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "other"), false, false)
+
+	assert.True(monitor.currentState().isActive())
+
+	assert.Eventually(func() bool {
+		return !monitor.currentState().isActive()
+	}, time.Second, 10*time.Millisecond)
+	assert.Len(monitor.stateChange, 2)
+}
+
+func newTestTerminatingEndpointSlice(serviceName string, serving bool, podNames ...string) *discovery.EndpointSlice {
+	endpointSlice := newTestEndpointSlice(serviceName, false, podNames...)
+	terminating := true
+	for i := range endpointSlice.Endpoints {
+		endpointSlice.Endpoints[i].Conditions.Serving = &serving
+		endpointSlice.Endpoints[i].Conditions.Terminating = &terminating
+	}
+
+	return endpointSlice
+}
+
+func TestProcessEndpointSlice_ServingPolicy_TerminatingDrains(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		EndpointPolicy:  endpointPolicyServing,
+		DeactivateDelay: time.Hour,
+	})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestTerminatingEndpointSlice("svc", true, "pod"), false, false)
+
+	// Draining is a deactivation, so waits for the delay
+	assert.Equal(activeStatus, monitor.currentState().status)
+
+	monitor.Config.DeactivateDelay = 0
+	monitor.processEndpointSlice(newTestTerminatingEndpointSlice("svc", true, "pod", "other"), false, false)
+
+	assert.Equal(drainingStatus, monitor.currentState().status)
+	assert.Equal([]types.NamespacedName{{Namespace: "default", Name: "svc"}}, monitor.currentState().serviceNames)
+}
+
+func TestProcessEndpointSlice_ServingPolicy_TerminatingNotServingInactive(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		EndpointPolicy: endpointPolicyServing,
+	})
+
+	monitor.processEndpointSlice(newTestTerminatingEndpointSlice("svc", true, "pod"), false, false)
+	assert.Equal(drainingStatus, monitor.currentState().status)
+
+	monitor.processEndpointSlice(newTestTerminatingEndpointSlice("svc", false, "pod"), false, false)
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+	assert.Empty(monitor.currentState().serviceNames)
+}
+
+func TestProcessEndpointSlice_ReadyPolicy_TerminatingInactive(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+
+	monitor.processEndpointSlice(newTestTerminatingEndpointSlice("svc", true, "pod"), false, false)
+
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+}
+
+func TestEndpointChangeReason(t *testing.T) {
+	svc := types.NamespacedName{Namespace: "default", Name: "svc"}
+
+	tests := []struct {
+		previous string
+		current  string
+		expected string
+	}{
+		{"", activeStatus, endpointAddedReason},
+		{activeStatus, "", endpointRemovedReason},
+		{inactiveStatus, activeStatus, endpointReadyReason},
+		{activeStatus, inactiveStatus, endpointUnreadyReason},
+		{activeStatus, drainingStatus, endpointTerminatingReason},
+		{activeStatus, activeStatus, ""},
+	}
+
+	for _, test := range tests {
+		previous := map[types.NamespacedName]string{}
+		if test.previous != "" {
+			previous[svc] = test.previous
+		}
+		current := map[types.NamespacedName]string{}
+		if test.current != "" {
+			current[svc] = test.current
+		}
+
+		assert.Equal(t, test.expected, endpointChangeReason(previous, current), "%s to %s", test.previous, test.current)
+	}
+}
+
+func TestProcessEndpointSlice_Resync_SetsReason(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	assert.Equal(endpointAddedReason, monitor.currentState().reason)
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, true)
+	assert.Equal(watchResyncReason, monitor.currentState().reason)
+}
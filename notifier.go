@@ -2,81 +2,423 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 )
 
 const (
 	activeStatus   = "active"
 	inactiveStatus = "inactive"
-
-	retryAttempts = 3
+	// The pod is terminating but still serving, so should finish existing work without taking more
+	drainingStatus = "draining"
+	// The pod is in the Argo Rollouts preview service but not the active service
+	previewStatus = "preview"
 )
 
 type stateChangeDto struct {
-	Status         string   `json:"status"`
+	Status string `json:"status"`
+	// Status before the most recent transition, empty if there has been no transition
+	PreviousStatus string `json:"previousStatus,omitempty"`
+	// Cause of the most recent change, such as EndpointAdded or EndpointUnready
+	Reason string `json:"reason,omitempty"`
+	// Incremented each time the state changes, so receivers can discard stale notifications
+	Generation uint64 `json:"generation,omitempty"`
+	// Time of the most recent change
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	// Names of the active services, kept for compatibility with existing receivers
 	ActiveServices []string `json:"activeServices"`
+	// Namespace and name of the active services
+	ActiveServiceRefs []serviceRefDto `json:"activeServiceRefs,omitempty"`
+	// True if the status was set manually using the override endpoint
+	Overridden bool `json:"overridden,omitempty"`
+	// Position of the pod among the ready pods in the active services, if sharding is enabled
+	Shard *shardDto `json:"shard,omitempty"`
 }
 
-var retryInterval, _ = time.ParseDuration("1s")
+type serviceRefDto struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
 
 var state = stateChangeDto{
 	Status:         inactiveStatus,
 	ActiveServices: []string{},
 }
 
+var (
+	// stateLock protects state and stateSubscribers.
+	stateLock sync.RWMutex
+
+	// stateSubscribers receive the new state each time it changes.
+	stateSubscribers = map[chan stateChangeDto]struct{}{}
+)
+
+// Returns a copy of the current state
+func getState() stateChangeDto {
+	stateLock.RLock()
+	defer stateLock.RUnlock()
+
+	return state
+}
+
+// Subscribes to state changes, returning the channel which will receive changes
+// and the current state at the time of subscription.
+func subscribeState() (chan stateChangeDto, stateChangeDto) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	// Buffer a single state, slow subscribers will skip to the latest state
+	updates := make(chan stateChangeDto, 1)
+	stateSubscribers[updates] = struct{}{}
+
+	return updates, state
+}
+
+// Unsubscribes from state changes
+func unsubscribeState(updates chan stateChangeDto) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	delete(stateSubscribers, updates)
+}
+
 func setStateChange(monitorState *monitorState, logger *zap.Logger) {
-	if monitorState.isActive {
-		state.Status = activeStatus
-	} else {
-		state.Status = inactiveStatus
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	status := monitorState.status
+	if status == "" {
+		status = inactiveStatus
 	}
 
-	state.ActiveServices = make([]string, 0, len(monitorState.serviceNames))
+	activeServices := make([]string, 0, len(monitorState.serviceNames))
+	activeServiceRefs := make([]serviceRefDto, 0, len(monitorState.serviceNames))
 	for _, serviceName := range monitorState.serviceNames {
-		state.ActiveServices = append(state.ActiveServices, serviceName.Name)
+		activeServices = append(activeServices, serviceName.Name)
+		activeServiceRefs = append(activeServiceRefs, serviceRefDto{
+			Namespace: serviceName.Namespace,
+			Name:      serviceName.Name,
+		})
+	}
+
+	shard := monitorState.shard.toDto()
+
+	// Resending an unchanged state keeps the same generation
+	if status != state.Status || !slices.Equal(activeServiceRefs, state.ActiveServiceRefs) ||
+		monitorState.overridden != state.Overridden || !reflect.DeepEqual(shard, state.Shard) {
+		if status != state.Status {
+			state.PreviousStatus = state.Status
+			state.Status = status
+		}
+
+		state.Generation++
+		state.Timestamp = monitorState.time
+		if state.Timestamp.IsZero() {
+			state.Timestamp = time.Now()
+		}
+		state.Reason = monitorState.reason
+		state.ActiveServices = activeServices
+		state.ActiveServiceRefs = activeServiceRefs
+		state.Overridden = monitorState.overridden
+		state.Shard = shard
+	}
+
+	for updates := range stateSubscribers {
+		// Replace any state the subscriber has not yet received
+		select {
+		case <-updates:
+		default:
+		}
+
+		updates <- state
 	}
 
 	logger.Debug("State changed.",
 		zap.String("status", state.Status),
+		zap.Uint64("generation", state.Generation),
 	)
 }
 
-func notifyStateChange(url string, logger *zap.Logger) error {
-	var err error
+// Configuration for a target which receives state change notifications
+type NotifierConfig struct {
+	URL string
+	// Command to execute instead of sending an HTTP request, if set
+	Command []string
+	// Exit codes from Command which indicate a failure which should not be retried
+	PermanentExitCodes []int
+	// Process to signal instead of sending an HTTP request, if set
+	Signal *SignalTarget
+
+	Method  string
+	Headers map[string]string
+	Timeout time.Duration
+	Retry   RetryPolicy
+	// Path to a file containing the secret used to sign requests, empty to disable signing
+	HMACSecretFile string
+	// Path to a file containing a bearer token for the Authorization header, empty to disable
+	BearerTokenFile string
+	// Format of the request body, json (default), cloudevents or cloudevents-binary
+	PayloadFormat string
+	// CloudEvents source and subject attributes
+	EventSource  string
+	EventSubject string
+}
+
+// Process which is sent a signal when the pod is activated or deactivated
+type SignalTarget struct {
+	// Name of the process, or the base name of its executable
+	ProcessName string `json:"process,omitempty"`
+	// Path to a file containing the process ID, used instead of ProcessName if set
+	PIDFile        string `json:"pidFile,omitempty"`
+	ActiveSignal   string `json:"active,omitempty"`
+	InactiveSignal string `json:"inactive,omitempty"`
+}
+
+// Returns an error if the signals are invalid, defaulting any which are not set
+func validateSignalTarget(target *SignalTarget) error {
+	if target.ActiveSignal == "" {
+		target.ActiveSignal = "SIGUSR1"
+	}
+	if target.InactiveSignal == "" {
+		target.InactiveSignal = "SIGUSR2"
+	}
+
+	if _, err := parseSignal(target.ActiveSignal); err != nil {
+		return err
+	}
+	if _, err := parseSignal(target.InactiveSignal); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns a description of the target for logging
+func (config *NotifierConfig) target() string {
+	if config.Signal != nil {
+		if config.Signal.PIDFile != "" {
+			return "signal:" + config.Signal.PIDFile
+		}
+		return "signal:" + config.Signal.ProcessName
+	}
+	if len(config.Command) > 0 {
+		return strings.Join(config.Command, " ")
+	}
+
+	return config.URL
+}
+
+// Delivers state changes to a single target, superseding any notification which
+// is still in flight or waiting to retry when a newer state is sent.
+type notifier struct {
+	config NotifierConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Last status successfully delivered, protected by waiting on done
+	delivered string
+
+	// Records failures against the pod, nil if disabled
+	events *podEventRecorder
+
+	// Client reused for each notification to a URL, so idle connections are reused rather than leaked
+	client     *http.Client
+	requestURL string
+	clientErr  error
+}
+
+func newNotifier(config NotifierConfig) *notifier {
+	notifier := &notifier{
+		config: config,
+	}
+	if config.Signal == nil && len(config.Command) == 0 {
+		notifier.client, notifier.requestURL, notifier.clientErr = newNotifierClient(config.URL)
+	}
+
+	return notifier
+}
+
+// Starts notifying the target of the state in the background
+func (notifier *notifier) start(state stateChangeDto, logger *zap.Logger) {
+	notifier.stop()
+
+	// Signals are only sent when the pod is activated or deactivated, not when the services
+	// change or are resent, and draining is treated the same as inactive
+	delivered := state.Status
+	if notifier.config.Signal != nil {
+		if delivered != activeStatus {
+			delivered = inactiveStatus
+		}
+		if delivered == notifier.delivered {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	notifier.cancel = cancel
+	notifier.done = done
+
+	go func() {
+		defer close(done)
+
+		logger.Debug("Sending state change notification...")
+		err := notifier.notify(ctx, state, logger)
+		if err == nil {
+			notifier.delivered = delivered
+		} else {
+			if errors.Is(err, context.Canceled) {
+				logger.Debug("State change notification superseded")
+			} else {
+				logger.Error("Error processing state change",
+					zap.Error(err))
+				notifier.events.event(corev1.EventTypeWarning, notificationFailedEventReason,
+					"Failed to notify "+notifier.config.target()+" of "+state.Status+" state: "+err.Error())
+			}
+		}
+	}()
+}
+
+// Cancels any in-flight notification and waits for it to exit, so notifications are never
+// delivered out of order.
+func (notifier *notifier) stop() {
+	if notifier.cancel != nil {
+		notifier.cancel()
+		<-notifier.done
+
+		notifier.cancel = nil
+		notifier.done = nil
+	}
+}
+
+// Describes a non-successful HTTP response from the application
+type statusError struct {
+	statusCode int
+	status     string
+	// Delay requested by the Retry-After header, if any
+	retryAfter time.Duration
+}
+
+func (err *statusError) Error() string {
+	return "notification rejected with status " + err.status
+}
+
+// Returns true if the request may succeed if retried
+func (err *statusError) retryable() bool {
+	return err.statusCode == http.StatusTooManyRequests || err.statusCode >= 500
+}
+
+func (err *statusError) retryDelay() time.Duration {
+	return err.retryAfter
+}
+
+// Parses a Retry-After header, which may be in seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// Notifies the target of the state, retrying on failure
+func (notifier *notifier) notify(ctx context.Context, state stateChangeDto, logger *zap.Logger) error {
+	config := &notifier.config
+	if config.Signal != nil {
+		return signalStateChange(ctx, config, state, logger)
+	}
+	if len(config.Command) > 0 {
+		return execStateChange(ctx, config, state, logger)
+	}
 
-	body, err := json.Marshal(&state)
+	// Build the payload once so the event ID is the same for all attempts
+	payload, err := buildPayload(config, state)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if notifier.clientErr != nil {
+		return notifier.clientErr
+	}
+
+	return retryNotification(ctx, config.Retry, config.target(), logger, func(ctx context.Context) error {
+		return notifyAttempt(ctx, notifier.client, notifier.requestURL, config, payload, logger)
+	})
+}
+
+// Makes a single attempt to notify the application, with a fresh request body
+func notifyAttempt(ctx context.Context, client *http.Client, requestURL string, config *NotifierConfig, payload *notificationPayload, logger *zap.Logger) error {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	method := config.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewReader(payload.body))
 	if err != nil {
 		return err
 	}
+	for name, value := range payload.headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if err := authenticateRequest(req, config, payload.body, time.Now()); err != nil {
+		return err
+	}
 
-	for i := 0; i < retryAttempts; i++ {
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if resp != nil {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-			defer resp.Body.Close()
+	// Drain the response so the connection may be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
 
-			logger.Debug("Notification result",
-				zap.String("status", resp.Status),
-			)
+	logger.Debug("Notification result",
+		zap.String("status", resp.Status),
+	)
 
-			if err == nil {
-				return nil
-			}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{
+			statusCode: resp.StatusCode,
+			status:     resp.Status,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
 		}
-
-		time.Sleep(retryInterval)
 	}
 
-	return err
+	return nil
 }
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Millisecond,
+	Multiplier:      1,
+}
+
+// Restores the initial global state
+func resetTestState() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	state = stateChangeDto{
+		Status:         inactiveStatus,
+		ActiveServices: []string{},
+	}
+}
+
+func TestSetStateChange_IncrementsGenerationOnChange(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Cleanup(resetTestState)
+
+	active := monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+		reason:       endpointAddedReason,
+	}
+
+	setStateChange(&active, zap.NewNop())
+	first := getState()
+
+	assert.Equal(uint64(1), first.Generation)
+	assert.Equal(inactiveStatus, first.PreviousStatus)
+	assert.Equal(endpointAddedReason, first.Reason)
+	assert.Equal([]serviceRefDto{{Namespace: "default", Name: "svc"}}, first.ActiveServiceRefs)
+	assert.False(first.Timestamp.IsZero())
+
+	// Resending the same state is not a new generation
+	setStateChange(&active, zap.NewNop())
+	assert.Equal(first, getState())
+
+	setStateChange(&monitorState{status: inactiveStatus, reason: endpointUnreadyReason}, zap.NewNop())
+	second := getState()
+
+	assert.Equal(uint64(2), second.Generation)
+	assert.Equal(activeStatus, second.PreviousStatus)
+	assert.Equal(endpointUnreadyReason, second.Reason)
+	assert.Empty(second.ActiveServiceRefs)
+}
+
+func TestNotifyStateChange_Success(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received.Add(1)
+		assert.Equal(http.MethodPost, req.Method)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+	assert.Equal(int32(1), received.Load())
+}
+
+func TestNotifyStateChange_ReusesConnections(t *testing.T) {
+	assert := assert.New(t)
+
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	notifier := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy})
+	for range 20 {
+		assert.Nil(notifier.notify(context.Background(), getState(), zap.NewNop()))
+	}
+
+	assert.Equal(int32(1), connections.Load())
+}
+
+func TestNotifyStateChange_Unreachable_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.NotNil(err)
+}
+
+func TestNotifyStateChange_Cancelled_StopsRetrying(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	policy := RetryPolicy{
+		InitialInterval: time.Millisecond,
+		Multiplier:      1,
+	}
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: policy}).notify(ctx, getState(), zap.NewNop())
+
+	assert.True(errors.Is(err, context.Canceled))
+}
+
+func TestNotifyStateChange_Deadline_StopsRetrying(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	policy := RetryPolicy{
+		InitialInterval: time.Millisecond,
+		Multiplier:      1,
+		Deadline:        20 * time.Millisecond,
+	}
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: policy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestNotifyStateChange_ServerError_Retries(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		assert.NotEmpty(body)
+
+		if received.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+	assert.Equal(int32(3), received.Load())
+}
+
+func TestNotifyStateChange_ClientError_DoesNotRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	var statusErr *statusError
+	if assert.True(errors.As(err, &statusErr)) {
+		assert.Equal(http.StatusBadRequest, statusErr.statusCode)
+	}
+	assert.Equal(int32(1), received.Load())
+}
+
+func TestNotifyStateChange_TooManyRequests_HonorsRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if received.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: time.Second, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+	assert.Equal(int32(2), received.Load())
+	assert.LessOrEqual(time.Second, time.Since(start))
+}
+
+func TestNotifyStateChange_SlowResponse_TimesOut(t *testing.T) {
+	assert := assert.New(t)
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if received.Add(1) == 1 {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := newNotifier(NotifierConfig{URL: server.URL, Timeout: 20 * time.Millisecond, Retry: testRetryPolicy}).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+	assert.Equal(int32(2), received.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(time.Duration(0), parseRetryAfter(""))
+	assert.Equal(5*time.Second, parseRetryAfter("5"))
+	assert.Equal(time.Duration(0), parseRetryAfter("invalid"))
+
+	delay := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.Greater(delay, 50*time.Second)
+}
+
+func TestNotifyStateChange_MethodAndHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodPut, req.Method)
+		assert.Equal("abc", req.Header.Get("X-Api-Key"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	config := &NotifierConfig{
+		URL:     server.URL,
+		Method:  http.MethodPut,
+		Headers: map[string]string{"X-Api-Key": "abc"},
+		Retry:   testRetryPolicy,
+	}
+
+	err := newNotifier(*config).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reasons for a change in state due to an override
+const (
+	overrideReason        = "Override"
+	overrideClearedReason = "OverrideCleared"
+	overrideExpiredReason = "OverrideExpired"
+)
+
+// Status set manually, regardless of the endpoints
+type stateOverride struct {
+	status string
+	// Time at which the override is removed, zero if it does not expire
+	expiresAt time.Time
+	// Removes the override when it expires
+	timer *time.Timer
+}
+
+// Body of a PUT request to /override
+type overrideRequestDto struct {
+	Status string `json:"status"`
+	// Duration after which the override is removed, such as 30m, empty if it does not expire
+	Duration string `json:"duration,omitempty"`
+}
+
+type overrideDto struct {
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// Overrides the status until cleared or the duration elapses, 0 for no expiry
+func (monitor *Monitor) setOverride(status string, duration time.Duration) overrideDto {
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	monitor.stopOverrideLocked()
+
+	override := &stateOverride{
+		status: status,
+	}
+	if duration > 0 {
+		override.expiresAt = time.Now().Add(duration)
+		override.timer = time.AfterFunc(duration, func() {
+			monitor.stateLock.Lock()
+			defer monitor.stateLock.Unlock()
+
+			if monitor.override != override {
+				// Replaced or cleared after the timer fired
+				return
+			}
+
+			monitor.Config.CreateChildLogger(monitor.Logger).Info("Override expired")
+			monitor.override = nil
+			monitor.observedReason = overrideExpiredReason
+			monitor.reconcileLocked()
+		})
+	}
+
+	monitor.Config.CreateChildLogger(monitor.Logger).Info("Override set",
+		zap.String("status", status),
+		zap.Duration("duration", duration))
+	monitor.override = override
+	monitor.reconcileLocked()
+
+	return overrideDto{
+		Status:    override.status,
+		ExpiresAt: override.expiresAt,
+	}
+}
+
+// Removes any override, returning to the state of the endpoints
+func (monitor *Monitor) clearOverride() {
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	if monitor.override == nil {
+		return
+	}
+
+	monitor.Config.CreateChildLogger(monitor.Logger).Info("Override cleared")
+	monitor.stopOverrideLocked()
+	monitor.observedReason = overrideClearedReason
+	monitor.reconcileLocked()
+}
+
+// Stops the expiry timer and removes the override. Must be called while holding stateLock.
+func (monitor *Monitor) stopOverrideLocked() {
+	if monitor.override != nil && monitor.override.timer != nil {
+		monitor.override.timer.Stop()
+	}
+	monitor.override = nil
+}
+
+// Returns true if the request has the bearer token from the override token file
+func (monitor *Monitor) authorizeOverride(req *http.Request) (bool, error) {
+	token, err := readSecretFile(monitor.Config.OverrideTokenFile)
+	if err != nil {
+		return false, err
+	}
+
+	bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false, nil
+	}
+
+	return subtle.ConstantTimeCompare([]byte(bearer), token) == 1, nil
+}
+
+// Handles PUT and DELETE requests to /override
+func (monitor *Monitor) overrideHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut && req.Method != http.MethodDelete {
+		w.Header().Set("Allow", "PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authorized, err := monitor.authorizeOverride(req)
+	if err != nil {
+		monitor.Logger.Error("Error reading override token",
+			zap.Error(err))
+		http.Error(w, "Unable to authorize request", http.StatusInternalServerError)
+		return
+	}
+	if !authorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if req.Method == http.MethodDelete {
+		monitor.clearOverride()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var request overrideRequestDto
+	if err := json.NewDecoder(io.LimitReader(req.Body, 64*1024)).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if request.Status != activeStatus && request.Status != inactiveStatus {
+		http.Error(w, fmt.Sprintf("Status must be %s or %s", activeStatus, inactiveStatus), http.StatusBadRequest)
+		return
+	}
+
+	duration := time.Duration(0)
+	if request.Duration != "" {
+		duration, err = time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, "Invalid duration: "+request.Duration, http.StatusBadRequest)
+			return
+		}
+	}
+
+	bytes, err := json.Marshal(monitor.setOverride(request.Status, duration))
+	if err != nil {
+		panic("Json encoding issue: " + err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(bytes); err != nil {
+		panic("Write issue: " + err.Error())
+	}
+}
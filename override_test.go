@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOverrideMonitor(t *testing.T) *Monitor {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestMonitor(MonitorConfig{
+		OverrideTokenFile: tokenFile,
+		ActivateDelay:     time.Hour,
+	})
+}
+
+func overrideRequest(monitor *Monitor, method string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/override", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	monitor.overrideHandler(w, req)
+
+	return w
+}
+
+func TestOverride_Unauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestOverrideMonitor(t)
+
+	assert.Equal(http.StatusUnauthorized, overrideRequest(monitor, "PUT", `{"status":"active"}`, "").Code)
+	assert.Equal(http.StatusUnauthorized, overrideRequest(monitor, "PUT", `{"status":"active"}`, "wrong").Code)
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+}
+
+func TestOverride_InvalidRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestOverrideMonitor(t)
+
+	assert.Equal(http.StatusBadRequest, overrideRequest(monitor, "PUT", `{"status":"draining"}`, "secret").Code)
+	assert.Equal(http.StatusBadRequest, overrideRequest(monitor, "PUT", `{"status":"active","duration":"soon"}`, "secret").Code)
+	assert.Equal(http.StatusMethodNotAllowed, overrideRequest(monitor, "GET", "", "secret").Code)
+}
+
+func TestOverride_PutAndDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestOverrideMonitor(t)
+
+	// Overrides apply immediately, regardless of the activate delay
+	w := overrideRequest(monitor, "PUT", `{"status":"active"}`, "secret")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal(`{"status":"active"}`, w.Body.String())
+
+	state := monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.True(state.overridden)
+	assert.Equal(overrideReason, state.reason)
+
+	// Changes to the endpoints don't affect the status
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod"), false, false)
+	assert.Equal(activeStatus, monitor.currentState().status)
+
+	w = overrideRequest(monitor, "DELETE", "", "secret")
+	assert.Equal(http.StatusNoContent, w.Code)
+
+	state = monitor.currentState()
+	assert.Equal(inactiveStatus, state.status)
+	assert.False(state.overridden)
+	assert.Equal(overrideClearedReason, state.reason)
+}
+
+func TestOverride_Expires(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestOverrideMonitor(t)
+	monitor.Config.ActivateDelay = 0
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	w := overrideRequest(monitor, "PUT", `{"status":"inactive","duration":"50ms"}`, "secret")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"expiresAt":`)
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+
+	assert.Eventually(func() bool {
+		state := monitor.currentState()
+		return state.status == activeStatus && !state.overridden && state.reason == overrideExpiredReason
+	}, time.Second, 10*time.Millisecond)
+}
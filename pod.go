@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Maximum time for a patch to the pod, so a slow API server does not delay later states indefinitely
+const podPatchTimeout = 10 * time.Second
+
+// Backoff between attempts to retry a failed patch to the pod, until it succeeds or a later state supersedes it
+var podPatchRetryPolicy = RetryPolicy{
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+const (
+	podConditionActiveReason   = "ServiceActive"
+	podConditionInactiveReason = "ServiceInactive"
+	podConditionDrainingReason = "ServiceDraining"
+	podConditionPreviewReason  = "ServicePreview"
+)
+
+// Patches the configured condition on the pod status to reflect the current state.
+// The patch is only sent when the condition status or reason changes, and the
+// LastTransitionTime is only updated when the status changes.
+func (monitor *Monitor) updatePodCondition(ctx context.Context, state *monitorState) error {
+	status := corev1.ConditionFalse
+	reason := podConditionInactiveReason
+	message := "Pod is not receiving traffic from any monitored service"
+	if state.isActive() {
+		status = corev1.ConditionTrue
+		reason = podConditionActiveReason
+
+		serviceNames := make([]string, 0, len(state.serviceNames))
+		for _, serviceName := range state.serviceNames {
+			serviceNames = append(serviceNames, serviceName.Name)
+		}
+		message = "Pod is receiving traffic from: " + strings.Join(serviceNames, ", ")
+	} else if state.status == drainingStatus {
+		reason = podConditionDrainingReason
+		message = "Pod is terminating and draining traffic"
+	} else if state.status == previewStatus {
+		reason = podConditionPreviewReason
+		message = "Pod is receiving traffic from the preview service"
+	}
+
+	if status == monitor.podConditionStatus && reason == monitor.podConditionReason {
+		// Already up to date, nothing to do
+		return nil
+	}
+
+	transitionTime := monitor.podConditionTime
+	if status != monitor.podConditionStatus {
+		transitionTime = metav1.Now()
+	}
+
+	// Pod conditions are merged by type using a strategic merge patch, so other conditions are left untouched
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{
+				{
+					Type:               corev1.PodConditionType(monitor.Config.PodConditionType),
+					Status:             status,
+					LastTransitionTime: transitionTime,
+					Reason:             reason,
+					Message:            message,
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, podPatchTimeout)
+	defer cancel()
+
+	_, err = monitor.clientset.CoreV1().Pods(monitor.Config.Namespace).Patch(
+		ctx,
+		monitor.Config.PodName,
+		types.StrategicMergePatchType,
+		body,
+		metav1.PatchOptions{},
+		"status")
+	if err != nil {
+		return err
+	}
+
+	monitor.podConditionStatus = status
+	monitor.podConditionReason = reason
+	monitor.podConditionTime = transitionTime
+	return nil
+}
+
+// Patches the configured label with the status and annotation with the active services onto
+// the pod. The patch is only sent when either value changes.
+func (monitor *Monitor) updatePodMetadata(ctx context.Context, state *monitorState) error {
+	status := state.status
+	if status == "" {
+		status = inactiveStatus
+	}
+
+	// Only active services are listed, not the services in which the pod is draining or previewing
+	services := []serviceRefDto{}
+	if state.isActive() {
+		for _, serviceName := range state.serviceNames {
+			services = append(services, serviceRefDto{
+				Namespace: serviceName.Namespace,
+				Name:      serviceName.Name,
+			})
+		}
+	}
+	servicesJSON, err := json.Marshal(services)
+	if err != nil {
+		return err
+	}
+
+	metadata := map[string]interface{}{}
+	if monitor.Config.StateLabel != "" {
+		metadata["labels"] = map[string]string{
+			monitor.Config.StateLabel: status,
+		}
+	}
+	if monitor.Config.StateAnnotation != "" {
+		metadata["annotations"] = map[string]string{
+			monitor.Config.StateAnnotation: string(servicesJSON),
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(body, monitor.podMetadataPatch) {
+		// Already up to date, nothing to do
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, podPatchTimeout)
+	defer cancel()
+
+	_, err = monitor.clientset.CoreV1().Pods(monitor.Config.Namespace).Patch(
+		ctx,
+		monitor.Config.PodName,
+		types.MergePatchType,
+		body,
+		metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	monitor.podMetadataPatch = body
+	return nil
+}
+
+// Applies a patch to the pod, retrying failures in the background independently of notifications
+type podPatchRetrier struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Stops any retry of an earlier patch, then attempts the patch. If it fails, it is retried with
+// backoff until it succeeds or start or stop is called again.
+func (retrier *podPatchRetrier) start(logger *zap.Logger, patch func(context.Context) error) {
+	retrier.stop()
+
+	err := patch(context.Background())
+	if err == nil {
+		return
+	}
+	logger.Error("Error patching pod, retrying",
+		zap.Error(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	retrier.cancel = cancel
+	retrier.done = done
+
+	go func() {
+		defer close(done)
+
+		for attempts := 1; ; attempts++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(podPatchRetryPolicy.interval(attempts)):
+			}
+
+			err := patch(ctx)
+			if err == nil {
+				logger.Info("Patched pod after retrying",
+					zap.Int("attempts", attempts+1))
+				return
+			}
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+
+			logger.Error("Error patching pod, retrying",
+				zap.Int("attempts", attempts+1),
+				zap.Error(err))
+		}
+	}()
+}
+
+// Cancels any retry in progress and waits for it to exit
+func (retrier *podPatchRetrier) stop() {
+	if retrier.cancel == nil {
+		return
+	}
+
+	retrier.cancel()
+	<-retrier.done
+	retrier.cancel = nil
+	retrier.done = nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testConditionType = "shawarma.centeredge.io/active"
+
+func newTestPodMonitor(pod *corev1.Pod) *Monitor {
+	monitor := NewMonitor(MonitorConfig{
+		Namespace:        pod.Namespace,
+		PodName:          pod.Name,
+		ServiceName:      "svc",
+		PodConditionType: testConditionType,
+	}, zap.NewNop())
+	monitor.clientset = fake.NewClientset(pod)
+
+	return &monitor
+}
+
+func newTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "pod",
+		},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func findPodCondition(t *testing.T, monitor *Monitor) *corev1.PodCondition {
+	pod, err := monitor.clientset.CoreV1().Pods(monitor.Config.Namespace).Get(context.TODO(), monitor.Config.PodName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == testConditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+func TestUpdatePodCondition_Active_SetsTrue(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+
+	err := monitor.updatePodCondition(context.TODO(), &monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+	})
+
+	assert.Nil(err)
+	condition := findPodCondition(t, monitor)
+	if assert.NotNil(condition) {
+		assert.Equal(corev1.ConditionTrue, condition.Status)
+		assert.Equal(podConditionActiveReason, condition.Reason)
+	}
+}
+
+func TestUpdatePodCondition_Inactive_SetsFalse(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+
+	err := monitor.updatePodCondition(context.TODO(), &monitorState{status: activeStatus})
+	assert.Nil(err)
+	err = monitor.updatePodCondition(context.TODO(), &monitorState{status: inactiveStatus})
+	assert.Nil(err)
+
+	condition := findPodCondition(t, monitor)
+	if assert.NotNil(condition) {
+		assert.Equal(corev1.ConditionFalse, condition.Status)
+		assert.Equal(podConditionInactiveReason, condition.Reason)
+	}
+}
+
+func TestUpdatePodCondition_Draining_SetsFalseWithReason(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+
+	err := monitor.updatePodCondition(context.TODO(), &monitorState{status: inactiveStatus})
+	assert.Nil(err)
+	err = monitor.updatePodCondition(context.TODO(), &monitorState{status: drainingStatus})
+	assert.Nil(err)
+
+	condition := findPodCondition(t, monitor)
+	if assert.NotNil(condition) {
+		assert.Equal(corev1.ConditionFalse, condition.Status)
+		assert.Equal(podConditionDrainingReason, condition.Reason)
+	}
+}
+
+func TestUpdatePodCondition_ReasonOnlyChange_KeepsTransitionTime(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+
+	err := monitor.updatePodCondition(context.TODO(), &monitorState{status: inactiveStatus})
+	assert.Nil(err)
+
+	// Transitioned an hour ago
+	transitionTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	monitor.podConditionTime = transitionTime
+
+	err = monitor.updatePodCondition(context.TODO(), &monitorState{status: drainingStatus})
+	assert.Nil(err)
+
+	condition := findPodCondition(t, monitor)
+	if assert.NotNil(condition) {
+		assert.Equal(podConditionDrainingReason, condition.Reason)
+		assert.True(transitionTime.Equal(&condition.LastTransitionTime))
+	}
+
+	err = monitor.updatePodCondition(context.TODO(), &monitorState{status: activeStatus})
+	assert.Nil(err)
+
+	condition = findPodCondition(t, monitor)
+	if assert.NotNil(condition) {
+		assert.False(transitionTime.Equal(&condition.LastTransitionTime))
+	}
+}
+
+func TestProcessStateChange_PodConditionFailed_Retries(t *testing.T) {
+	assert := assert.New(t)
+
+	previous := podPatchRetryPolicy
+	podPatchRetryPolicy = RetryPolicy{InitialInterval: 10 * time.Millisecond}
+	t.Cleanup(func() { podPatchRetryPolicy = previous })
+
+	monitor := newTestPodMonitor(newTestPod())
+	monitor.Config.DisableStateNotifier = true
+	client := monitor.clientset.(*fake.Clientset)
+
+	failures := 2
+	client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+
+	t.Cleanup(resetTestState)
+	monitor.processStateChange(monitorState{status: activeStatus})
+	t.Cleanup(monitor.podConditionRetrier.stop)
+
+	assert.Eventually(func() bool {
+		condition := findPodCondition(t, monitor)
+		return condition != nil && condition.Status == corev1.ConditionTrue
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestUpdatePodCondition_PreservesOtherConditions(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+
+	err := monitor.updatePodCondition(context.TODO(), &monitorState{status: activeStatus})
+	assert.Nil(err)
+
+	pod, _ := monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+	assert.Len(pod.Status.Conditions, 2)
+}
+
+func TestUpdatePodCondition_Unchanged_SkipsPatch(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+	client := monitor.clientset.(*fake.Clientset)
+
+	_ = monitor.updatePodCondition(context.TODO(), &monitorState{status: activeStatus})
+	_ = monitor.updatePodCondition(context.TODO(), &monitorState{status: activeStatus})
+
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	assert.Equal(1, patches)
+}
+
+func TestUpdatePodMetadata_SetsLabelAndAnnotation(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+	monitor.Config.StateLabel = "shawarma.centeredge.io/state"
+	monitor.Config.StateAnnotation = "shawarma.centeredge.io/active-services"
+
+	err := monitor.updatePodMetadata(context.TODO(), &monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+	})
+	assert.Nil(err)
+
+	pod, _ := monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+	assert.Equal(activeStatus, pod.Labels["shawarma.centeredge.io/state"])
+	assert.Equal(`[{"namespace":"default","name":"svc"}]`, pod.Annotations["shawarma.centeredge.io/active-services"])
+
+	// Services in which the pod is draining are not active
+	err = monitor.updatePodMetadata(context.TODO(), &monitorState{
+		status:       drainingStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+	})
+	assert.Nil(err)
+
+	pod, _ = monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+	assert.Equal(drainingStatus, pod.Labels["shawarma.centeredge.io/state"])
+	assert.Equal(`[]`, pod.Annotations["shawarma.centeredge.io/active-services"])
+
+	err = monitor.updatePodMetadata(context.TODO(), &monitorState{status: inactiveStatus})
+	assert.Nil(err)
+
+	pod, _ = monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+	assert.Equal(inactiveStatus, pod.Labels["shawarma.centeredge.io/state"])
+	assert.Equal(`[]`, pod.Annotations["shawarma.centeredge.io/active-services"])
+}
+
+func TestUpdatePodMetadata_LabelOnly_SkipsUnchanged(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestPodMonitor(newTestPod())
+	monitor.Config.StateLabel = "shawarma.centeredge.io/state"
+	client := monitor.clientset.(*fake.Clientset)
+
+	_ = monitor.updatePodMetadata(context.TODO(), &monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+	})
+	// Changes to the services don't change the label
+	_ = monitor.updatePodMetadata(context.TODO(), &monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "other"}},
+	})
+
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	assert.Equal(1, patches)
+
+	pod, _ := monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+	assert.Empty(pod.Annotations)
+}
+
+func TestProcessStateChange_PodMetadataFailed_Retries(t *testing.T) {
+	assert := assert.New(t)
+
+	previous := podPatchRetryPolicy
+	podPatchRetryPolicy = RetryPolicy{InitialInterval: 10 * time.Millisecond}
+	t.Cleanup(func() { podPatchRetryPolicy = previous })
+
+	monitor := newTestPodMonitor(newTestPod())
+	monitor.Config.DisableStateNotifier = true
+	monitor.Config.PodConditionType = ""
+	monitor.Config.StateLabel = "shawarma.centeredge.io/state"
+	client := monitor.clientset.(*fake.Clientset)
+
+	failures := 2
+	client.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+
+	t.Cleanup(resetTestState)
+	monitor.processStateChange(monitorState{status: activeStatus})
+	t.Cleanup(monitor.podMetadataRetrier.stop)
+
+	assert.Eventually(func() bool {
+		pod, err := monitor.clientset.CoreV1().Pods("default").Get(context.TODO(), "pod", metav1.GetOptions{})
+		return err == nil && pod.Labels["shawarma.centeredge.io/state"] == activeStatus
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Controls how failed notifications are retried
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first, or 0 to retry until successful
+	MaxAttempts int
+	// Delay before the first retry
+	InitialInterval time.Duration
+	// Maximum delay between retries, or 0 for no maximum
+	MaxInterval time.Duration
+	// Factor by which the delay is increased after each retry
+	Multiplier float64
+	// Fraction of the delay, from 0 to 1, which is randomized to avoid retrying in lockstep
+	Jitter float64
+	// Maximum total time spent notifying, including retries, or 0 for no deadline
+	Deadline time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// Returns true if another attempt should be made after the given number of attempts
+func (policy *RetryPolicy) shouldRetry(attempts int) bool {
+	return policy.MaxAttempts <= 0 || attempts < policy.MaxAttempts
+}
+
+// Returns the delay before the next attempt after the given number of attempts
+func (policy *RetryPolicy) interval(attempts int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval := float64(policy.InitialInterval) * math.Pow(multiplier, float64(attempts-1))
+	if policy.MaxInterval > 0 && interval > float64(policy.MaxInterval) {
+		interval = float64(policy.MaxInterval)
+	}
+
+	if policy.Jitter > 0 {
+		jitter := math.Min(policy.Jitter, 1)
+
+		// Randomize within +/- jitter of the interval
+		interval += interval * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(interval)
+}
+
+// Implemented by errors which indicate whether a failed notification may succeed if retried
+type retryableError interface {
+	error
+	retryable() bool
+	// Delay requested before retrying, or 0 to use the retry policy
+	retryDelay() time.Duration
+}
+
+// Calls attempt until it succeeds, the retry policy is exhausted, or the context is cancelled.
+// Errors which implement retryableError may stop retries or request a delay. Attempts are
+// recorded in the notification metrics under the target.
+func retryNotification(ctx context.Context, policy RetryPolicy, target string, logger *zap.Logger, attempt func(context.Context) error) error {
+	if policy.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, policy.Deadline)
+		defer cancel()
+	}
+
+	for attempts := 1; ; attempts++ {
+		notificationAttemptsCounter.WithLabelValues(target).Inc()
+		start := time.Now()
+		err := attempt(ctx)
+		notificationDuration.WithLabelValues(target).Observe(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+
+		notificationFailuresCounter.WithLabelValues(target).Inc()
+
+		interval := time.Duration(0)
+		var retryableErr retryableError
+		if errors.As(err, &retryableErr) {
+			if !retryableErr.retryable() {
+				return err
+			}
+
+			// Honor a delay requested by the target, such as Retry-After, but no longer than the policy allows
+			interval = retryableErr.retryDelay()
+			if policy.MaxInterval > 0 && interval > policy.MaxInterval {
+				interval = policy.MaxInterval
+			}
+		}
+
+		if !policy.shouldRetry(attempts) {
+			return err
+		}
+
+		if interval == 0 {
+			interval = policy.interval(attempts)
+		}
+		if deadline, ok := ctx.Deadline(); ok && interval > time.Until(deadline) {
+			// Waiting beyond the deadline only delays reporting the failure
+			interval = max(time.Until(deadline), 0)
+		}
+
+		logger.Debug("Notification failed, retrying",
+			zap.Int("attempts", attempts),
+			zap.Duration("interval", interval),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(interval):
+			if ctx.Err() != nil {
+				return errors.Join(err, ctx.Err())
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRetryPolicy_Interval_Exponential(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		Multiplier:      2,
+	}
+
+	assert.Equal(1*time.Second, policy.interval(1))
+	assert.Equal(2*time.Second, policy.interval(2))
+	assert.Equal(4*time.Second, policy.interval(3))
+}
+
+func TestRetryPolicy_Interval_Capped(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     3 * time.Second,
+		Multiplier:      2,
+	}
+
+	assert.Equal(3*time.Second, policy.interval(3))
+	assert.Equal(3*time.Second, policy.interval(10))
+}
+
+func TestRetryPolicy_Interval_Jitter(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		Multiplier:      1,
+		Jitter:          0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		interval := policy.interval(1)
+		assert.GreaterOrEqual(interval, 500*time.Millisecond)
+		assert.LessOrEqual(interval, 1500*time.Millisecond)
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	limited := RetryPolicy{MaxAttempts: 3}
+	assert.True(limited.shouldRetry(2))
+	assert.False(limited.shouldRetry(3))
+
+	unlimited := RetryPolicy{MaxAttempts: 0}
+	assert.True(unlimited.shouldRetry(1000))
+}
+
+func TestRetryNotification_RecordsMetricsByTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+
+	failures := 1
+	err := retryNotification(context.Background(), policy, "http://localhost/metrics-test", zap.NewNop(), func(ctx context.Context) error {
+		if failures > 0 {
+			failures--
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	assert.Nil(err)
+	assert.Equal(2.0, testutil.ToFloat64(notificationAttemptsCounter.WithLabelValues("http://localhost/metrics-test")))
+	assert.Equal(1.0, testutil.ToFloat64(notificationFailuresCounter.WithLabelValues("http://localhost/metrics-test")))
+}
+
+func TestRetryNotification_RetryAfter_CappedAtMaxInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{MaxAttempts: 2, InitialInterval: time.Millisecond, MaxInterval: 10 * time.Millisecond}
+
+	attempts := 0
+	start := time.Now()
+	err := retryNotification(context.Background(), policy, "retry-after-test", zap.NewNop(), func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return &statusError{statusCode: 503, status: "503 Service Unavailable", retryAfter: time.Hour}
+		}
+		return nil
+	})
+
+	assert.Nil(err)
+	assert.Equal(2, attempts)
+	assert.Less(time.Since(start), 5*time.Second)
+}
+
+func TestRetryNotification_RetryAfter_CappedAtDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := RetryPolicy{InitialInterval: time.Millisecond, Deadline: 50 * time.Millisecond}
+
+	start := time.Now()
+	err := retryNotification(context.Background(), policy, "retry-after-test", zap.NewNop(), func(ctx context.Context) error {
+		return &statusError{statusCode: 503, status: "503 Service Unavailable", retryAfter: time.Hour}
+	})
+
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Less(time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Label which Argo Rollouts adds to pods and to the selectors of the active and preview services
+	rolloutPodTemplateHashLabel = "rollouts-pod-template-hash"
+
+	// Reason for a change in state when Argo Rollouts switches the selector of a service
+	rolloutSelectorChangedReason = "RolloutSelectorChanged"
+)
+
+// Returns the label selector for the EndpointSlices of the active and preview services
+func (config *MonitorConfig) rolloutLabelSelector() string {
+	serviceNames := []string{config.RolloutActiveService}
+	if config.RolloutPreviewService != "" {
+		serviceNames = append(serviceNames, config.RolloutPreviewService)
+	}
+
+	requirement, err := labels.NewRequirement(discovery.LabelServiceName, selection.In, serviceNames)
+	if err != nil {
+		panic("Invalid rollout service name: " + err.Error())
+	}
+
+	return requirement.String()
+}
+
+// Computes the state from the active and preview services. The pod is active if ready in the active
+// service, or preview if only ready in the preview service. Must be called while holding stateLock.
+func (monitor *Monitor) rolloutStateLocked() monitorState {
+	activeService := types.NamespacedName{Namespace: monitor.Config.Namespace, Name: monitor.Config.RolloutActiveService}
+
+	switch monitor.rolloutEndpointStatusLocked(activeService) {
+	case activeStatus:
+		return monitorState{
+			status:       activeStatus,
+			serviceNames: []types.NamespacedName{activeService},
+			reason:       monitor.observedReason,
+			shard:        monitor.shardAssignmentLocked(activeStatus),
+		}
+	case drainingStatus:
+		return monitorState{
+			status:       drainingStatus,
+			serviceNames: []types.NamespacedName{activeService},
+			reason:       monitor.observedReason,
+		}
+	}
+
+	if monitor.Config.RolloutPreviewService != "" {
+		previewService := types.NamespacedName{Namespace: monitor.Config.Namespace, Name: monitor.Config.RolloutPreviewService}
+
+		if monitor.rolloutEndpointStatusLocked(previewService) == activeStatus {
+			return monitorState{
+				status:       previewStatus,
+				serviceNames: []types.NamespacedName{previewService},
+				reason:       monitor.observedReason,
+			}
+		}
+	}
+
+	return monitorState{
+		status:       inactiveStatus,
+		serviceNames: []types.NamespacedName{},
+		reason:       monitor.observedReason,
+	}
+}
+
+// Returns the status of the pod's endpoint in the service, treating the pod as inactive if the
+// service's selector no longer matches its pod template hash, even if the EndpointSlices have yet
+// to be updated. Must be called while holding stateLock.
+func (monitor *Monitor) rolloutEndpointStatusLocked(serviceName types.NamespacedName) string {
+	status, ok := monitor.observedEndpointStatuses[serviceName]
+	if !ok {
+		return inactiveStatus
+	}
+
+	if !monitor.rolloutSelectorMatchesLocked(serviceName.Name) {
+		return inactiveStatus
+	}
+
+	return status
+}
+
+// Returns true unless both the pod template hash of the pod and the service's selector are known and
+// differ. Must be called while holding stateLock.
+func (monitor *Monitor) rolloutSelectorMatchesLocked(serviceName string) bool {
+	hash := monitor.rolloutServiceHashes[serviceName]
+
+	return hash == "" || monitor.rolloutPodHash == "" || hash == monitor.rolloutPodHash
+}
+
+// Records the pod template hash selected by the service, or removes it if the service is nil
+func (monitor *Monitor) processRolloutService(serviceName string, service *corev1.Service) {
+	hash := ""
+	if service != nil {
+		hash = service.Spec.Selector[rolloutPodTemplateHashLabel]
+	}
+
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	if monitor.rolloutServiceHashes[serviceName] == hash {
+		return
+	}
+
+	previous := monitor.rolloutSelectorMatchesLocked(serviceName)
+	if monitor.rolloutServiceHashes == nil {
+		monitor.rolloutServiceHashes = map[string]string{}
+	}
+	monitor.rolloutServiceHashes[serviceName] = hash
+
+	monitor.Config.CreateChildLogger(monitor.Logger).Info("Rollout service selector changed",
+		zap.String("service", serviceName),
+		zap.String("hash", hash))
+
+	if previous != monitor.rolloutSelectorMatchesLocked(serviceName) {
+		monitor.observedReason = rolloutSelectorChangedReason
+	}
+
+	monitor.reconcileLocked()
+}
+
+// Looks up the pod template hash of the pod, which does not change for the life of the pod
+func (monitor *Monitor) lookupRolloutPodHash() {
+	pod, err := monitor.clientset.CoreV1().Pods(monitor.Config.Namespace).Get(context.TODO(), monitor.Config.PodName, metav1.GetOptions{})
+	if err != nil {
+		// Fall back to only the EndpointSlices
+		monitor.Logger.Error("Error getting pod template hash",
+			zap.Error(err))
+		return
+	}
+
+	hash := pod.Labels[rolloutPodTemplateHashLabel]
+	if hash == "" {
+		monitor.Logger.Warn("Pod has no pod template hash, is it managed by Argo Rollouts?",
+			zap.String("label", rolloutPodTemplateHashLabel))
+	}
+
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	monitor.rolloutPodHash = hash
+	monitor.reconcileLocked()
+}
+
+// Watches the selectors of the active and preview services until the monitor is stopped
+func (monitor *Monitor) watchRolloutServices() {
+	monitor.lookupRolloutPodHash()
+
+	serviceNames := []string{monitor.Config.RolloutActiveService}
+	if monitor.Config.RolloutPreviewService != "" {
+		serviceNames = append(serviceNames, monitor.Config.RolloutPreviewService)
+	}
+
+	var wg sync.WaitGroup
+	for _, serviceName := range serviceNames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			monitor.watchRolloutService(serviceName)
+		}()
+	}
+	wg.Wait()
+}
+
+func (monitor *Monitor) watchRolloutService(serviceName string) {
+	watchList := cache.NewFilteredListWatchFromClient(
+		monitor.clientset.CoreV1().RESTClient(),
+		"services",
+		monitor.Config.Namespace,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", serviceName).String()
+		},
+	)
+
+	_, controller := cache.NewInformerWithOptions(
+		cache.InformerOptions{
+			ListerWatcher: watchList,
+			ObjectType:    &corev1.Service{},
+			ResyncPeriod:  time.Second * 0,
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: func(obj interface{}) {
+					monitor.Logger.Debug("rollout service added")
+					monitor.processRolloutService(serviceName, obj.(*corev1.Service))
+				},
+				DeleteFunc: func(obj interface{}) {
+					monitor.Logger.Debug("rollout service deleted")
+					monitor.processRolloutService(serviceName, nil)
+				},
+				UpdateFunc: func(oldObj, newObj interface{}) {
+					monitor.Logger.Debug("rollout service changed")
+					monitor.processRolloutService(serviceName, newObj.(*corev1.Service))
+				},
+			},
+		})
+
+	controller.Run(monitor.stop)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestRolloutMonitor() *Monitor {
+	monitor := newTestMonitor(MonitorConfig{})
+	monitor.Config.ServiceName = ""
+	monitor.Config.RolloutActiveService = "active"
+	monitor.Config.RolloutPreviewService = "preview"
+
+	return monitor
+}
+
+func newTestRolloutService(name string, hash string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{
+				"app":                       "my-app",
+				rolloutPodTemplateHashLabel: hash,
+			},
+		},
+	}
+}
+
+func TestRolloutLabelSelector(t *testing.T) {
+	assert := assert.New(t)
+
+	config := MonitorConfig{RolloutActiveService: "active"}
+	assert.Equal("kubernetes.io/service-name in (active)", config.rolloutLabelSelector())
+
+	config.RolloutPreviewService = "preview"
+	assert.Equal("kubernetes.io/service-name in (active,preview)", config.rolloutLabelSelector())
+}
+
+func TestRollout_PreviewThenPromoted(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestRolloutMonitor()
+
+	monitor.processEndpointSlice(newTestEndpointSlice("preview", true, "pod"), false, false)
+
+	state := monitor.currentState()
+	assert.Equal(previewStatus, state.status)
+	assert.Equal("preview", state.serviceNames[0].Name)
+
+	// The active service takes precedence once promoted
+	monitor.processEndpointSlice(newTestEndpointSlice("active", true, "pod"), false, false)
+
+	state = monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.Len(state.serviceNames, 1)
+	assert.Equal("active", state.serviceNames[0].Name)
+}
+
+func TestRollout_NotReadyInPreview_Inactive(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestRolloutMonitor()
+
+	monitor.processEndpointSlice(newTestEndpointSlice("preview", false, "pod"), false, false)
+
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+}
+
+func TestRollout_SelectorChanged_DeactivatesBeforeEndpointSlices(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestRolloutMonitor()
+	monitor.rolloutPodHash = "old"
+
+	monitor.processRolloutService("active", newTestRolloutService("active", "old"))
+	monitor.processRolloutService("preview", newTestRolloutService("preview", "new"))
+	monitor.processEndpointSlice(newTestEndpointSlice("active", true, "pod"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("preview", true, "pod"), false, false)
+	assert.Equal(activeStatus, monitor.currentState().status)
+
+	// Argo Rollouts switches the active service to the new pods
+	monitor.processRolloutService("active", newTestRolloutService("active", "new"))
+
+	state := monitor.currentState()
+	assert.Equal(inactiveStatus, state.status)
+	assert.Equal(rolloutSelectorChangedReason, state.reason)
+}
+
+func TestLookupRolloutPodHash(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestRolloutMonitor()
+
+	pod := newTestPod()
+	pod.Labels = map[string]string{rolloutPodTemplateHashLabel: "abc123"}
+	monitor.clientset = fake.NewClientset(pod)
+
+	monitor.lookupRolloutPodHash()
+
+	assert.Equal("abc123", monitor.rolloutPodHash)
+}
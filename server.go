@@ -4,13 +4,102 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+// Interval between keep alive comments on idle event streams
+var streamKeepAliveInterval = 15 * time.Second
+
+// Maximum time a request to /deploymentstate may wait for the state to change
+var maxStateWait = 5 * time.Minute
+
+// Distinguishes ETags from previous runs of the sidecar, since the generation restarts from zero
+var stateETagEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// Returns the ETag for the state, which changes with the generation
+func stateETag(state *stateChangeDto) string {
+	return `"` + stateETagEpoch + "-" + strconv.FormatUint(state.Generation, 10) + `"`
+}
+
+// Returns true if the If-None-Match header includes the ETag
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Parses the wait query parameter, which may be a duration such as 30s or a number of seconds
+func parseStateWait(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, secondsErr := strconv.Atoi(value)
+		if secondsErr != nil {
+			return 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, fmt.Errorf("invalid wait %q", value)
+	}
+
+	return min(wait, maxStateWait), nil
+}
+
 // Handlers
 func deploymentState(w http.ResponseWriter, req *http.Request) {
-	bytes, err := json.Marshal(&state)
+	wait, err := parseStateWait(req.URL.Query().Get("wait"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentState := getState()
+	ifNoneMatch := req.Header.Get("If-None-Match")
+	if ifNoneMatch != "" && wait > 0 && etagMatches(ifNoneMatch, stateETag(&currentState)) {
+		// Long poll until the state changes from the one the client already has
+		updates, subscribedState := subscribeState()
+		defer unsubscribeState(updates)
+
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+
+		currentState = subscribedState
+	L:
+		for etagMatches(ifNoneMatch, stateETag(&currentState)) {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-timeout.C:
+				break L
+			case currentState = <-updates:
+			}
+		}
+	}
+
+	etag := stateETag(&currentState)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	bytes, err := json.Marshal(&currentState)
 	if err != nil {
 		panic("Json encoding issue: " + err.Error())
 	}
@@ -23,6 +112,56 @@ func deploymentState(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+func deploymentStateStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, currentState := subscribeState()
+	defer unsubscribeState(updates)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		bytes, err := json.Marshal(&currentState)
+		if err != nil {
+			panic("Json encoding issue: " + err.Error())
+		}
+
+		if _, err := fmt.Fprintf(w, "event: state\ndata: %s\n\n", bytes); err != nil {
+			// Client has disconnected
+			return
+		}
+		flusher.Flush()
+
+	L:
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+
+			case currentState = <-updates:
+				break L
+
+			case <-keepAlive.C:
+				// Comment lines are ignored by clients, but keep proxies from closing idle connections
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
 func _health(w http.ResponseWriter, req *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -31,12 +170,37 @@ func _health(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(w, `{"health": "ok"}`)
 }
 
-// Http Server
-func httpServer(port uint16, logger *zap.Logger) {
+// Http Server, listening on a Unix domain socket if socketPath is set or otherwise the port
+func httpServer(port uint16, socketPath string, monitor *Monitor, logger *zap.Logger) {
 
 	// Endpoints Handlers
 	http.HandleFunc("/deploymentstate", deploymentState)
+	http.HandleFunc("/deploymentstate/stream", deploymentStateStream)
+	http.HandleFunc("/livez", monitor.health.livez)
+	http.HandleFunc("/readyz", monitor.health.readyz)
+	// Always succeeds, so existing liveness probes don't restart the sidecar when the watch fails
 	http.HandleFunc("/_health", _health)
+	if monitor.Config.OverrideTokenFile != "" {
+		http.HandleFunc("/override", monitor.overrideHandler)
+	}
+	http.Handle("/metrics", promhttp.Handler())
+
+	if socketPath != "" {
+		logger.Info("Starting HTTP Server",
+			zap.String("socket", socketPath))
+
+		listener, err := listenUnix(socketPath)
+		if err != nil {
+			panic("Error: " + err.Error())
+		}
+
+		err = http.Serve(listener, nil)
+		if err != nil {
+			panic("Error: " + err.Error())
+		}
+
+		return
+	}
 
 	logger.Info("Starting HTTP Server",
 		zap.Uint16("port", port))
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type Endpoint struct {
@@ -18,6 +22,7 @@ type Endpoint struct {
 
 var serverEndpoints = []Endpoint{
 	{"GET", "/_health", `{"health": "ok"}`},
+	{"GET", "/livez", `{"health":"ok"}`},
 	{"GET", "/deploymentstate", `{"status":"inactive","activeServices":[]}`},
 }
 
@@ -51,8 +56,129 @@ func router(endpoint Endpoint, w *httptest.ResponseRecorder, req *http.Request)
 	if endpoint.url == "/_health" {
 		_health(w, req)
 	}
+	if endpoint.url == "/livez" {
+		newWatchHealth(0, 0).livez(w, req)
+	}
 	if endpoint.url == "/deploymentstate" {
 		deploymentState(w, req)
 	}
 
 }
+
+func TestDeploymentStateStream(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(deploymentStateStream))
+	defer server.Close()
+	t.Cleanup(resetTestState)
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		event := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("expected error to be nil got %v", err)
+			}
+			if line == "\n" {
+				return event
+			}
+			event += line
+		}
+	}
+
+	// Receives the current state on connect
+	assert.Equal("event: state\ndata: {\"status\":\"inactive\",\"activeServices\":[]}\n", readEvent())
+
+	setStateChange(&monitorState{
+		status:       activeStatus,
+		serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+		reason:       endpointAddedReason,
+		time:         time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, zap.NewNop())
+
+	// Receives the change
+	assert.Equal("event: state\ndata: "+
+		`{"status":"active","previousStatus":"inactive","reason":"EndpointAdded","generation":1,"timestamp":"2024-01-02T03:04:05Z",`+
+		`"activeServices":["svc"],"activeServiceRefs":[{"namespace":"default","name":"svc"}]}`+"\n", readEvent())
+}
+
+func TestDeploymentState_IfNoneMatch_NotModified(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/deploymentstate", nil)
+	w := httptest.NewRecorder()
+	deploymentState(w, req)
+
+	etag := w.Result().Header.Get("ETag")
+	assert.NotEmpty(etag)
+
+	req = httptest.NewRequest("GET", "/deploymentstate", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	deploymentState(w, req)
+
+	assert.Equal(http.StatusNotModified, w.Result().StatusCode)
+	assert.Equal(etag, w.Result().Header.Get("ETag"))
+	assert.Empty(w.Body.String())
+}
+
+func TestDeploymentState_Wait_ReturnsOnChange(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Cleanup(resetTestState)
+
+	current := getState()
+	etag := stateETag(&current)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// Resending the same state does not end the wait
+		setStateChange(&monitorState{status: inactiveStatus}, zap.NewNop())
+		setStateChange(&monitorState{
+			status:       activeStatus,
+			serviceNames: []types.NamespacedName{{Namespace: "default", Name: "svc"}},
+		}, zap.NewNop())
+	}()
+
+	req := httptest.NewRequest("GET", "/deploymentstate?wait=5s", nil)
+	req.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	deploymentState(w, req)
+
+	assert.Equal(http.StatusOK, w.Result().StatusCode)
+	assert.NotEqual(etag, w.Result().Header.Get("ETag"))
+	assert.Contains(w.Body.String(), `"status":"active"`)
+}
+
+func TestDeploymentState_Wait_TimesOut(t *testing.T) {
+	assert := assert.New(t)
+
+	current := getState()
+
+	req := httptest.NewRequest("GET", "/deploymentstate?wait=1", nil)
+	req.Header.Set("If-None-Match", stateETag(&current))
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	deploymentState(w, req)
+
+	assert.Equal(http.StatusNotModified, w.Result().StatusCode)
+	assert.GreaterOrEqual(time.Since(start), time.Second)
+}
+
+func TestDeploymentState_InvalidWait_BadRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/deploymentstate?wait=soon", nil)
+	w := httptest.NewRecorder()
+	deploymentState(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
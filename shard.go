@@ -0,0 +1,107 @@
+package main
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+// Reason for a change in state when other pods join or leave the services
+const shardMembersChangedReason = "ShardMembersChanged"
+
+// Position of the pod among the ready pods in its active services
+type shardAssignment struct {
+	// Index of the pod within pods, and the number of pods
+	index int
+	count int
+	// Names of the ready pods, sorted
+	pods []string
+	// Partitions assigned to the pod, if ShardPartitions is set
+	partitions []int
+}
+
+type shardDto struct {
+	Index int      `json:"index"`
+	Count int      `json:"count"`
+	Pods  []string `json:"pods"`
+	// Partitions assigned to this pod using rendezvous hashing, stable as other pods join or leave
+	Partitions []int `json:"partitions,omitempty"`
+}
+
+func (shard *shardAssignment) toDto() *shardDto {
+	if shard == nil {
+		return nil
+	}
+
+	return &shardDto{
+		Index:      shard.index,
+		Count:      shard.count,
+		Pods:       shard.pods,
+		Partitions: shard.partitions,
+	}
+}
+
+// Computes the shard assignment if the status is active, nil if sharding is disabled or the pod is
+// not one of the ready pods. Must be called while holding stateLock.
+func (monitor *Monitor) shardAssignmentLocked(status string) *shardAssignment {
+	if !monitor.Config.Sharding || status != activeStatus {
+		return nil
+	}
+
+	index := slices.Index(monitor.observedShardPods, monitor.Config.PodName)
+	if index < 0 {
+		// Active due to an override without being ready in the services
+		return nil
+	}
+
+	shard := &shardAssignment{
+		index: index,
+		count: len(monitor.observedShardPods),
+		pods:  monitor.observedShardPods,
+	}
+	if monitor.Config.ShardPartitions > 0 {
+		shard.partitions = assignPartitions(monitor.observedShardPods, monitor.Config.PodName, monitor.Config.ShardPartitions)
+	}
+
+	return shard
+}
+
+// Returns the partitions, from 0 to count-1, assigned to the pod using rendezvous hashing. Each partition
+// is assigned to the pod with the highest hash of the pod and partition, so only the partitions of a pod
+// which joins or leaves are reassigned.
+func assignPartitions(pods []string, podName string, count int) []int {
+	partitions := []int{}
+	for partition := range count {
+		suffix := "/" + strconv.Itoa(partition)
+
+		var owner string
+		var ownerWeight uint64
+		for _, pod := range pods {
+			weight := rendezvousWeight(pod + suffix)
+			if owner == "" || weight > ownerWeight || (weight == ownerWeight && pod < owner) {
+				owner = pod
+				ownerWeight = weight
+			}
+		}
+
+		if owner == podName {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	return partitions
+}
+
+func rendezvousWeight(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+
+	// Mix the bits, FNV alone distributes keys differing only in their last characters poorly
+	weight := hash.Sum64()
+	weight ^= weight >> 30
+	weight *= 0xbf58476d1ce4e5b9
+	weight ^= weight >> 27
+	weight *= 0x94d049bb133111eb
+	weight ^= weight >> 31
+	return weight
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignPartitions_AssignsEachPartitionOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	pods := []string{"pod-a", "pod-b", "pod-c"}
+
+	owners := map[int]string{}
+	for _, pod := range pods {
+		for _, partition := range assignPartitions(pods, pod, 32) {
+			_, duplicate := owners[partition]
+			assert.False(duplicate, "partition %d assigned twice", partition)
+			owners[partition] = pod
+		}
+	}
+
+	assert.Len(owners, 32)
+}
+
+func TestAssignPartitions_OnlyMovesPartitionsOfRemovedPod(t *testing.T) {
+	assert := assert.New(t)
+
+	pods := []string{"pod-a", "pod-b", "pod-c"}
+	remaining := []string{"pod-a", "pod-b"}
+
+	for _, pod := range remaining {
+		before := assignPartitions(pods, pod, 32)
+		after := assignPartitions(remaining, pod, 32)
+
+		for _, partition := range before {
+			assert.True(slices.Contains(after, partition), "partition %d moved from %s", partition, pod)
+		}
+	}
+}
+
+func TestProcessEndpointSlice_Sharding(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		Sharding:        true,
+		ShardPartitions: 8,
+	})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "web-b", "pod", "api-a"), false, false)
+
+	state := monitor.currentState()
+	if assert.NotNil(state.shard) {
+		assert.Equal(1, state.shard.index)
+		assert.Equal(3, state.shard.count)
+		assert.Equal([]string{"api-a", "pod", "web-b"}, state.shard.pods)
+		assert.Equal(assignPartitions(state.shard.pods, "pod", 8), state.shard.partitions)
+	}
+
+	// Another pod leaving changes the shard without changing the status
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod", "api-a"), false, false)
+
+	state = monitor.currentState()
+	assert.Equal(activeStatus, state.status)
+	assert.Equal(shardMembersChangedReason, state.reason)
+	if assert.NotNil(state.shard) {
+		assert.Equal(1, state.shard.index)
+		assert.Equal(2, state.shard.count)
+	}
+
+	// Only active pods have a shard
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", false, "pod", "api-a"), false, false)
+
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+	assert.Nil(monitor.currentState().shard)
+}
+
+func TestProcessEndpointSlice_ShardingDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{})
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod", "pod-a"), false, false)
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	assert.Nil(monitor.currentState().shard)
+	assert.Equal(endpointAddedReason, monitor.currentState().reason)
+}
+
+func TestProcessEndpointSlice_Sharding_MultipleSlices(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		Sharding: true,
+	})
+
+	second := newTestEndpointSlice("svc", true, "pod", "api-a")
+	second.Name = "svc-def"
+
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod", "web-b"), false, false)
+	monitor.processEndpointSlice(second, false, false)
+
+	state := monitor.currentState()
+	assert.Len(state.serviceNames, 1)
+	if assert.NotNil(state.shard) {
+		assert.Equal([]string{"api-a", "pod", "web-b"}, state.shard.pods)
+	}
+}
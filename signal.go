@@ -0,0 +1,132 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// Location of the proc filesystem, used to find processes by name
+var procPath = "/proc"
+
+// Notifies of a state change by sending a signal to the target process, retrying on failure
+func signalStateChange(ctx context.Context, config *NotifierConfig, state stateChangeDto, logger *zap.Logger) error {
+	signalName := config.Signal.InactiveSignal
+	if state.Status == activeStatus {
+		signalName = config.Signal.ActiveSignal
+	}
+
+	signal, err := parseSignal(signalName)
+	if err != nil {
+		return err
+	}
+
+	return retryNotification(ctx, config.Retry, config.target(), logger, func(ctx context.Context) error {
+		pids, err := findSignalTargets(config.Signal)
+		if err != nil {
+			return err
+		}
+
+		for _, pid := range pids {
+			logger.Debug("Sending signal",
+				zap.Int("pid", pid),
+				zap.String("signal", unix.SignalName(signal)),
+			)
+
+			if err := unix.Kill(pid, signal); err != nil {
+				return fmt.Errorf("error sending %s to process %d: %w", unix.SignalName(signal), pid, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Parses a signal name, with or without the SIG prefix, or number
+func parseSignal(name string) (syscall.Signal, error) {
+	if number, err := strconv.Atoi(name); err == nil && number > 0 {
+		return syscall.Signal(number), nil
+	}
+
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, errors.New("unknown signal: " + name)
+	}
+
+	return signal, nil
+}
+
+// Finds the process IDs to signal, from the PID file if configured or otherwise by process name
+func findSignalTargets(target *SignalTarget) ([]int, error) {
+	if target.PIDFile != "" {
+		data, err := os.ReadFile(target.PIDFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid PID in %s", target.PIDFile)
+		}
+
+		return []int{pid}, nil
+	}
+
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return nil, err
+	}
+
+	self := os.Getpid()
+	pids := []int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+
+		if processMatches(filepath.Join(procPath, entry.Name()), target.ProcessName) {
+			pids = append(pids, pid)
+		}
+	}
+
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no process found named %s, is shareProcessNamespace enabled?", target.ProcessName)
+	}
+
+	return pids, nil
+}
+
+// Returns true if the process name or the base name of its executable matches
+func processMatches(processPath string, name string) bool {
+	if comm, err := os.ReadFile(filepath.Join(processPath, "comm")); err == nil {
+		if strings.TrimSpace(string(comm)) == name {
+			return true
+		}
+	}
+
+	// comm is truncated to 15 characters, so also check the first argument of the command line
+	if cmdline, err := os.ReadFile(filepath.Join(processPath, "cmdline")); err == nil {
+		argv0, _, _ := strings.Cut(string(cmdline), "\x00")
+		if argv0 != "" && filepath.Base(argv0) == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+var errSignalUnsupported = errors.New("signal notifications are not supported on this platform")
+
+func signalStateChange(ctx context.Context, config *NotifierConfig, state stateChangeDto, logger *zap.Logger) error {
+	return errSignalUnsupported
+}
+
+func parseSignal(name string) (int, error) {
+	return 0, errSignalUnsupported
+}
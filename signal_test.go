@@ -0,0 +1,148 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseSignal(t *testing.T) {
+	assert := assert.New(t)
+
+	signal, err := parseSignal("SIGUSR1")
+	assert.Nil(err)
+	assert.Equal(syscall.SIGUSR1, signal)
+
+	signal, err = parseSignal("usr2")
+	assert.Nil(err)
+	assert.Equal(syscall.SIGUSR2, signal)
+
+	signal, err = parseSignal("15")
+	assert.Nil(err)
+	assert.Equal(syscall.SIGTERM, signal)
+
+	_, err = parseSignal("SIGNOTREAL")
+	assert.NotNil(err)
+}
+
+func TestFindSignalTargets_ProcessName(t *testing.T) {
+	assert := assert.New(t)
+
+	proc := t.TempDir()
+	writeTestProcess(t, proc, "100", "nginx\n", "/usr/sbin/nginx\x00-g\x00")
+	writeTestProcess(t, proc, "101", "long-process-na\n", "/app/long-process-name\x00")
+	writeTestProcess(t, proc, "102", "other\n", "/bin/other\x00")
+
+	original := procPath
+	procPath = proc
+	t.Cleanup(func() { procPath = original })
+
+	pids, err := findSignalTargets(&SignalTarget{ProcessName: "nginx"})
+	assert.Nil(err)
+	assert.Equal([]int{100}, pids)
+
+	pids, err = findSignalTargets(&SignalTarget{ProcessName: "long-process-name"})
+	assert.Nil(err)
+	assert.Equal([]int{101}, pids)
+
+	_, err = findSignalTargets(&SignalTarget{ProcessName: "missing"})
+	assert.NotNil(err)
+}
+
+func writeTestProcess(t *testing.T, proc string, pid string, comm string, cmdline string) {
+	dir := filepath.Join(proc, pid)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "comm"), []byte(comm), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644)
+}
+
+func TestSignalStateChange_PIDFile(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	_ = os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+
+	config := &NotifierConfig{
+		Signal: &SignalTarget{
+			PIDFile:        pidFile,
+			ActiveSignal:   "SIGUSR1",
+			InactiveSignal: "SIGTERM",
+		},
+		Retry: testRetryPolicy,
+	}
+
+	err := signalStateChange(context.Background(), config, stateChangeDto{Status: inactiveStatus}, zap.NewNop())
+	assert.Nil(err)
+
+	select {
+	case err := <-exited:
+		if exitErr, ok := err.(*exec.ExitError); assert.True(ok) {
+			status := exitErr.Sys().(syscall.WaitStatus)
+			assert.Equal(syscall.SIGTERM, status.Signal())
+		}
+	case <-time.After(5 * time.Second):
+		_ = cmd.Process.Kill()
+		t.Fatal("expected process to receive signal")
+	}
+}
+
+func TestNotifier_Signal_OnlyOnStatusChange(t *testing.T) {
+	assert := assert.New(t)
+
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	notifier := newNotifier(NotifierConfig{
+		Signal: &SignalTarget{
+			PIDFile:        pidFile,
+			ActiveSignal:   "SIGUSR1",
+			InactiveSignal: "SIGUSR2",
+		},
+		Retry: RetryPolicy{MaxAttempts: 1},
+	})
+
+	// Simulate a previously delivered active signal
+	notifier.delivered = activeStatus
+
+	notifier.start(stateChangeDto{Status: activeStatus, ActiveServices: []string{"svc2"}}, zap.NewNop())
+
+	// No notification is started, so there is nothing to wait on
+	assert.Nil(notifier.done)
+}
+
+func TestNotifier_Signal_DrainingAfterInactive_NotResent(t *testing.T) {
+	assert := assert.New(t)
+
+	notifier := newNotifier(NotifierConfig{
+		Signal: &SignalTarget{
+			PIDFile:        filepath.Join(t.TempDir(), "app.pid"),
+			ActiveSignal:   "SIGUSR1",
+			InactiveSignal: "SIGUSR2",
+		},
+		Retry: RetryPolicy{MaxAttempts: 1},
+	})
+
+	// Draining sends the inactive signal, so is already delivered
+	notifier.delivered = inactiveStatus
+
+	notifier.start(stateChangeDto{Status: drainingStatus}, zap.NewNop())
+
+	assert.Nil(notifier.done)
+}
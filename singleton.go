@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Timing of the singleton lease, variables so that tests may shorten them
+var (
+	singletonLeaseDuration = 15 * time.Second
+	singletonRenewDeadline = 10 * time.Second
+	singletonRetryPeriod   = 2 * time.Second
+)
+
+// Reasons for a change in state due to the singleton lease
+const (
+	leaseAcquiredReason = "LeaseAcquired"
+	leaseLostReason     = "LeaseLost"
+)
+
+// Signals whether the pod should hold the singleton lease, replacing any signal not yet received.
+// Must be called while holding stateLock.
+func (monitor *Monitor) signalSingletonLocked(eligible bool) {
+	if monitor.Config.SingletonLease == "" || eligible == monitor.singletonSignaled {
+		return
+	}
+
+	select {
+	case <-monitor.singletonEligible:
+	default:
+	}
+	monitor.singletonEligible <- eligible
+	monitor.singletonSignaled = eligible
+}
+
+// Records whether the pod holds the singleton lease and reconciles the state
+func (monitor *Monitor) setLeaseHeld(ctx context.Context, held bool) {
+	monitor.stateLock.Lock()
+	defer monitor.stateLock.Unlock()
+
+	if held && ctx.Err() != nil {
+		// Already stopped leading before this callback ran
+		return
+	}
+	if held == monitor.leaseHeld {
+		return
+	}
+
+	childLogger := monitor.Config.CreateChildLogger(monitor.Logger)
+	if held {
+		childLogger.Info("Singleton lease acquired",
+			zap.String("lease", monitor.Config.SingletonLease))
+		monitor.observedReason = leaseAcquiredReason
+	} else {
+		childLogger.Info("Singleton lease lost",
+			zap.String("lease", monitor.Config.SingletonLease))
+		if monitor.endpointStateLocked().isActive() {
+			// Otherwise the lease was released after the pod left the services, which is the reason
+			monitor.observedReason = leaseLostReason
+		}
+	}
+
+	monitor.leaseHeld = held
+	monitor.reconcileLocked()
+}
+
+func (monitor *Monitor) newSingletonElector() (*leaderelection.LeaderElector, error) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: monitor.Config.Namespace,
+			Name:      monitor.Config.SingletonLease,
+		},
+		Client: monitor.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: monitor.Config.PodName,
+		},
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            monitor.Config.SingletonLease,
+		LeaseDuration:   singletonLeaseDuration,
+		RenewDeadline:   singletonRenewDeadline,
+		RetryPeriod:     singletonRetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				monitor.setLeaseHeld(ctx, true)
+			},
+			OnStoppedLeading: func() {
+				monitor.setLeaseHeld(context.Background(), false)
+			},
+		},
+	})
+}
+
+// Campaigns for the singleton lease while the pod is active in the services, releasing it when the
+// pod is no longer active or the monitor is stopped. Closes done once the lease is released.
+func (monitor *Monitor) runSingleton(done chan struct{}) {
+	defer close(done)
+
+	for eligible := false; ; {
+		// Wait until the pod is active in the services
+		for !eligible {
+			select {
+			case <-monitor.stop:
+				return
+			case eligible = <-monitor.singletonEligible:
+			}
+		}
+
+		var stopped bool
+		eligible, stopped = monitor.campaignSingleton()
+		if stopped {
+			return
+		}
+	}
+}
+
+// Campaigns for the lease until it is lost, the pod is no longer eligible, or the monitor is stopped
+func (monitor *Monitor) campaignSingleton() (eligible bool, stopped bool) {
+	// Each campaign uses a new elector, so no state is carried over from a lost lease
+	elector, err := monitor.newSingletonElector()
+	if err != nil {
+		monitor.Logger.Error("Error creating leader elector",
+			zap.Error(err))
+		return false, true
+	}
+
+	monitor.Logger.Debug("Campaigning for singleton lease")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	campaignDone := make(chan struct{})
+	go func() {
+		defer close(campaignDone)
+		elector.Run(ctx)
+	}()
+
+	for {
+		select {
+		case <-monitor.stop:
+			cancel()
+			<-campaignDone
+			return false, true
+
+		case eligible := <-monitor.singletonEligible:
+			if !eligible {
+				cancel()
+				<-campaignDone
+				return false, false
+			}
+
+		case <-campaignDone:
+			// Lost the lease, campaign again if still eligible
+			return true, false
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func init() {
+	singletonLeaseDuration = time.Second
+	singletonRenewDeadline = 500 * time.Millisecond
+	singletonRetryPeriod = 50 * time.Millisecond
+}
+
+func newTestSingletonMonitor(t *testing.T, clientset kubernetes.Interface, podName string) *Monitor {
+	monitor := newTestMonitor(MonitorConfig{
+		SingletonLease: "shawarma-svc",
+	})
+	monitor.Config.PodName = podName
+	monitor.clientset = clientset
+	monitor.stop = make(chan struct{})
+
+	done := make(chan struct{})
+	go monitor.runSingleton(done)
+	t.Cleanup(func() {
+		close(monitor.stop)
+		<-done
+	})
+
+	return monitor
+}
+
+func TestSingleton_NotActiveWithoutLease(t *testing.T) {
+	assert := assert.New(t)
+
+	monitor := newTestMonitor(MonitorConfig{
+		SingletonLease: "shawarma-svc",
+	})
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+
+	assert.Equal(inactiveStatus, monitor.currentState().status)
+	assert.True(<-monitor.singletonEligible)
+}
+
+func TestSingleton_OnlyOnePodActive(t *testing.T) {
+	assert := assert.New(t)
+
+	clientset := fake.NewClientset()
+	first := newTestSingletonMonitor(t, clientset, "pod-a")
+	second := newTestSingletonMonitor(t, clientset, "pod-b")
+
+	first.processEndpointSlice(newTestEndpointSlice("svc", true, "pod-a", "pod-b"), false, false)
+	assert.Eventually(func() bool {
+		return first.currentState().status == activeStatus
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(leaseAcquiredReason, first.currentState().reason)
+
+	second.processEndpointSlice(newTestEndpointSlice("svc", true, "pod-a", "pod-b"), false, false)
+	assert.Never(func() bool {
+		return second.currentState().status == activeStatus
+	}, 300*time.Millisecond, 10*time.Millisecond)
+
+	// The lease is released once the first pod is no longer ready
+	first.processEndpointSlice(newTestEndpointSlice("svc", false, "pod-a"), false, false)
+	assert.Eventually(func() bool {
+		return second.currentState().status == activeStatus
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(inactiveStatus, first.currentState().status)
+}
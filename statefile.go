@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Writes the state to the configured state and marker files, if any
+func writeStateFiles(stateFile string, markerFile string, state stateChangeDto) error {
+	var errs []error
+
+	if stateFile != "" {
+		data, err := json.Marshal(&state)
+		if err == nil {
+			err = writeFileAtomic(stateFile, append(data, '\n'))
+		}
+		errs = append(errs, err)
+	}
+
+	if markerFile != "" {
+		errs = append(errs, writeFileAtomic(markerFile, []byte(state.Status+"\n")))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Replaces the contents of a file by writing to a temporary file in the same directory and
+// renaming it, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// CreateTemp uses 0600, allow other containers in the pod to read the file
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
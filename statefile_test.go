@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteStateFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+	markerFile := filepath.Join(dir, "status")
+
+	err := writeStateFiles(stateFile, markerFile, stateChangeDto{
+		Status:         activeStatus,
+		ActiveServices: []string{"svc"},
+	})
+	assert.Nil(err)
+
+	data, err := os.ReadFile(stateFile)
+	if assert.Nil(err) {
+		assert.Equal("{\"status\":\"active\",\"activeServices\":[\"svc\"]}\n", string(data))
+	}
+
+	data, err = os.ReadFile(markerFile)
+	if assert.Nil(err) {
+		assert.Equal("active\n", string(data))
+	}
+}
+
+func TestWriteStateFiles_ReplacesExisting(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	markerFile := filepath.Join(dir, "status")
+
+	assert.Nil(writeStateFiles("", markerFile, stateChangeDto{Status: activeStatus}))
+	assert.Nil(writeStateFiles("", markerFile, stateChangeDto{Status: inactiveStatus}))
+
+	data, err := os.ReadFile(markerFile)
+	if assert.Nil(err) {
+		assert.Equal("inactive\n", string(data))
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Len(entries, 1)
+
+	info, err := os.Stat(markerFile)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0644), info.Mode().Perm())
+	}
+}
+
+func TestWriteStateFiles_MissingDirectory_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := writeStateFiles(filepath.Join(t.TempDir(), "missing", "state.json"), "", getState())
+
+	assert.NotNil(err)
+}
+
+func TestWriteSyncedStateFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	markerFile := filepath.Join(t.TempDir(), "status")
+
+	monitor := newTestMonitor(MonitorConfig{MarkerFile: markerFile})
+	monitor.writeSyncedStateFiles()
+
+	data, err := os.ReadFile(markerFile)
+	assert.Nil(err)
+	assert.Equal(inactiveStatus+"\n", string(data))
+}
+
+func TestWriteSyncedStateFiles_StatePublished_LeavesFile(t *testing.T) {
+	assert := assert.New(t)
+
+	markerFile := filepath.Join(t.TempDir(), "status")
+	assert.Nil(os.WriteFile(markerFile, []byte(activeStatus+"\n"), 0644))
+
+	// The file is written when the published state is processed, not with the stale global state
+	monitor := newTestMonitor(MonitorConfig{MarkerFile: markerFile})
+	monitor.processEndpointSlice(newTestEndpointSlice("svc", true, "pod"), false, false)
+	monitor.writeSyncedStateFiles()
+
+	data, err := os.ReadFile(markerFile)
+	assert.Nil(err)
+	assert.Equal(activeStatus+"\n", string(data))
+}
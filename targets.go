@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Target entry within a targets file, any values which are not set use the defaults
+// supplied on the command line
+type targetFileEntry struct {
+	URL                string            `json:"url,omitempty"`
+	Command            []string          `json:"command,omitempty"`
+	PermanentExitCodes []int             `json:"permanentExitCodes,omitempty"`
+	Signal             *SignalTarget     `json:"signal,omitempty"`
+	Method             string            `json:"method,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	Timeout            *metav1.Duration  `json:"timeout,omitempty"`
+	Retry              *retryFileEntry   `json:"retry,omitempty"`
+
+	HMACSecretFile  string `json:"hmacSecretFile,omitempty"`
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+	PayloadFormat   string `json:"payloadFormat,omitempty"`
+}
+
+// Retry policy within a targets file entry
+type retryFileEntry struct {
+	MaxAttempts     *int             `json:"maxAttempts,omitempty"`
+	InitialInterval *metav1.Duration `json:"initialInterval,omitempty"`
+	MaxInterval     *metav1.Duration `json:"maxInterval,omitempty"`
+	Multiplier      *float64         `json:"multiplier,omitempty"`
+	Jitter          *float64         `json:"jitter,omitempty"`
+	Deadline        *metav1.Duration `json:"deadline,omitempty"`
+}
+
+// Loads notification targets from a YAML or JSON file containing a list of targets
+func loadTargetsFile(path string, defaults NotifierConfig) ([]NotifierConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTargets(data, defaults)
+}
+
+func parseTargets(data []byte, defaults NotifierConfig) ([]NotifierConfig, error) {
+	var entries []targetFileEntry
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return nil, err
+	}
+
+	targets := make([]NotifierConfig, 0, len(entries))
+	for i, entry := range entries {
+		kinds := 0
+		for _, set := range []bool{entry.URL != "", len(entry.Command) > 0, entry.Signal != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("target %d must have exactly one of url, command or signal", i)
+		}
+
+		if entry.Signal != nil {
+			if entry.Signal.ProcessName == "" && entry.Signal.PIDFile == "" {
+				return nil, fmt.Errorf("target %d must have a signal process or pidFile", i)
+			}
+			if err := validateSignalTarget(entry.Signal); err != nil {
+				return nil, fmt.Errorf("target %d: %w", i, err)
+			}
+		}
+
+		target := defaults
+		target.URL = entry.URL
+		target.Command = entry.Command
+		target.Signal = entry.Signal
+
+		if entry.PermanentExitCodes != nil {
+			target.PermanentExitCodes = entry.PermanentExitCodes
+		}
+
+		if entry.Method != "" {
+			target.Method = entry.Method
+		}
+		if len(entry.Headers) > 0 {
+			target.Headers = entry.Headers
+		}
+		if entry.Timeout != nil {
+			target.Timeout = entry.Timeout.Duration
+		}
+		if entry.Retry != nil {
+			entry.Retry.applyTo(&target.Retry)
+		}
+		if entry.HMACSecretFile != "" {
+			target.HMACSecretFile = entry.HMACSecretFile
+		}
+		if entry.BearerTokenFile != "" {
+			target.BearerTokenFile = entry.BearerTokenFile
+		}
+		if entry.PayloadFormat != "" {
+			if err := validatePayloadFormat(entry.PayloadFormat); err != nil {
+				return nil, fmt.Errorf("target %d: %w", i, err)
+			}
+			target.PayloadFormat = entry.PayloadFormat
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+func (entry *retryFileEntry) applyTo(policy *RetryPolicy) {
+	if entry.MaxAttempts != nil {
+		policy.MaxAttempts = *entry.MaxAttempts
+	}
+	if entry.InitialInterval != nil {
+		policy.InitialInterval = entry.InitialInterval.Duration
+	}
+	if entry.MaxInterval != nil {
+		policy.MaxInterval = entry.MaxInterval.Duration
+	}
+	if entry.Multiplier != nil {
+		policy.Multiplier = *entry.Multiplier
+	}
+	if entry.Jitter != nil {
+		policy.Jitter = *entry.Jitter
+	}
+	if entry.Deadline != nil {
+		policy.Deadline = entry.Deadline.Duration
+	}
+}
+
+// Parses headers in the form "Name: value"
+func parseHeaders(headers []string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(headers))
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", header)
+		}
+
+		result[name] = strings.TrimSpace(value)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTargetDefaults = NotifierConfig{
+	Method:  "POST",
+	Timeout: 10 * time.Second,
+	Retry:   defaultRetryPolicy,
+}
+
+func TestParseTargets_AppliesDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	targets, err := parseTargets([]byte(`
+- url: http://localhost:8080/applicationstate
+`), testTargetDefaults)
+
+	assert.Nil(err)
+	if assert.Len(targets, 1) {
+		assert.Equal("http://localhost:8080/applicationstate", targets[0].URL)
+		assert.Equal("POST", targets[0].Method)
+		assert.Equal(10*time.Second, targets[0].Timeout)
+		assert.Equal(defaultRetryPolicy, targets[0].Retry)
+	}
+}
+
+func TestParseTargets_OverridesDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	targets, err := parseTargets([]byte(`
+- url: http://localhost:8080/applicationstate
+- url: http://localhost:9090/state
+  method: PUT
+  headers:
+    X-Api-Key: abc
+  timeout: 2s
+  retry:
+    maxAttempts: 0
+    initialInterval: 500ms
+`), testTargetDefaults)
+
+	assert.Nil(err)
+	if assert.Len(targets, 2) {
+		target := targets[1]
+		assert.Equal("http://localhost:9090/state", target.URL)
+		assert.Equal("PUT", target.Method)
+		assert.Equal(map[string]string{"X-Api-Key": "abc"}, target.Headers)
+		assert.Equal(2*time.Second, target.Timeout)
+		assert.Equal(0, target.Retry.MaxAttempts)
+		assert.Equal(500*time.Millisecond, target.Retry.InitialInterval)
+		assert.Equal(defaultRetryPolicy.MaxInterval, target.Retry.MaxInterval)
+	}
+}
+
+func TestParseTargets_MissingURL_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := parseTargets([]byte(`
+- method: PUT
+`), testTargetDefaults)
+
+	assert.NotNil(err)
+}
+
+func TestParseTargets_UnknownField_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := parseTargets([]byte(`
+- url: http://localhost/applicationstate
+  unknown: true
+`), testTargetDefaults)
+
+	assert.NotNil(err)
+}
+
+func TestParseHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	headers, err := parseHeaders([]string{"X-Api-Key: abc", "X-Other:def"})
+
+	assert.Nil(err)
+	assert.Equal(map[string]string{"X-Api-Key": "abc", "X-Other": "def"}, headers)
+
+	_, err = parseHeaders([]string{"invalid"})
+	assert.NotNil(err)
+}
+
+func TestParseTargets_Command(t *testing.T) {
+	assert := assert.New(t)
+
+	targets, err := parseTargets([]byte(`
+- command: ["/hooks/state", "--verbose"]
+  permanentExitCodes: [2]
+`), testTargetDefaults)
+
+	assert.Nil(err)
+	if assert.Len(targets, 1) {
+		assert.Equal([]string{"/hooks/state", "--verbose"}, targets[0].Command)
+		assert.Equal([]int{2}, targets[0].PermanentExitCodes)
+		assert.Equal("/hooks/state --verbose", targets[0].target())
+	}
+}
+
+func TestParseTargets_URLAndCommand_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := parseTargets([]byte(`
+- url: http://localhost/applicationstate
+  command: ["/hooks/state"]
+`), testTargetDefaults)
+
+	assert.NotNil(err)
+}
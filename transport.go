@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	unixScheme = "unix"
+
+	// Request path for Unix socket URLs which do not specify one
+	defaultUnixRequestPath = "/applicationstate"
+)
+
+// Creates the HTTP client and request URL for a notification URL. URLs in the form
+// unix:///path/to/app.sock connect via a Unix domain socket, with the request path
+// taken from the optional "path" query parameter.
+func newNotifierClient(rawURL string) (*http.Client, string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if parsed.Scheme != unixScheme {
+		return &http.Client{}, rawURL, nil
+	}
+
+	socketPath := parsed.Path
+	if socketPath == "" {
+		return nil, "", errors.New("missing socket path in URL: " + rawURL)
+	}
+
+	query := parsed.Query()
+	requestPath := query.Get("path")
+	if requestPath == "" {
+		requestPath = defaultUnixRequestPath
+	}
+	query.Del("path")
+
+	requestURL := url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     requestPath,
+		RawQuery: query.Encode(),
+	}
+
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+			IdleConnTimeout: 90 * time.Second,
+		},
+	}
+
+	return client, requestURL.String(), nil
+}
+
+// Listens on a Unix domain socket, replacing any stale socket left by a previous run
+func listenUnix(socketPath string) (net.Listener, error) {
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow access by other containers running as the same group, such as via fsGroup
+	if err := os.Chmod(socketPath, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
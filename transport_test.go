@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestUnixServer(t *testing.T, handler http.Handler) string {
+	socketPath := filepath.Join(t.TempDir(), "app.sock")
+
+	listener, err := listenUnix(socketPath)
+	if err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return socketPath
+}
+
+func TestNewNotifierClient_HTTP_Unchanged(t *testing.T) {
+	assert := assert.New(t)
+
+	_, requestURL, err := newNotifierClient("http://localhost:8080/applicationstate")
+
+	assert.Nil(err)
+	assert.Equal("http://localhost:8080/applicationstate", requestURL)
+}
+
+func TestNewNotifierClient_Unix_RequestPath(t *testing.T) {
+	assert := assert.New(t)
+
+	_, requestURL, err := newNotifierClient("unix:///var/run/app.sock")
+	assert.Nil(err)
+	assert.Equal("http://localhost/applicationstate", requestURL)
+
+	_, requestURL, err = newNotifierClient("unix:///var/run/app.sock?path=/state&a=b")
+	assert.Nil(err)
+	assert.Equal("http://localhost/state?a=b", requestURL)
+}
+
+func TestNewNotifierClient_Unix_MissingPath_ReturnsError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := newNotifierClient("unix://")
+
+	assert.NotNil(err)
+}
+
+func TestNotifyStateChange_UnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	received := make(chan string, 1)
+	socketPath := newTestUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received <- req.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	config := &NotifierConfig{
+		URL:   "unix://" + socketPath + "?path=/state",
+		Retry: testRetryPolicy,
+	}
+
+	err := newNotifier(*config).notify(context.Background(), getState(), zap.NewNop())
+
+	assert.Nil(err)
+	assert.Equal("/state", <-received)
+}
+
+func TestListenUnix_ReplacesStaleSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	socketPath := filepath.Join(t.TempDir(), "server.sock")
+	if err := os.WriteFile(socketPath, []byte{}, 0600); err != nil {
+		t.Fatalf("expected error to be nil got %v", err)
+	}
+
+	listener, err := listenUnix(socketPath)
+	if assert.Nil(err) {
+		defer listener.Close()
+
+		info, err := os.Stat(socketPath)
+		if assert.Nil(err) {
+			assert.Equal(os.ModeSocket, info.Mode()&os.ModeSocket)
+			assert.Equal(os.FileMode(0660), info.Mode().Perm())
+		}
+	}
+}